@@ -3,66 +3,555 @@
 // Author: blinklv <blinklv@icloud.com>
 // Create Time: 2020-06-18
 // Maintainer: blinklv <blinklv@icloud.com>
-// Last Change: 2020-06-18
+// Last Change: 2026-10-19
 
 package util
 
 import (
 	"bytes"
+	"fmt"
+	"math/bits"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // BufferPool is a buffer pool which can reduce GC overhead.
 type BufferPool struct {
-	pool sync.Pool
+	// 64-bit fields accessed atomically must be placed at first to ensure
+	// 64-bit alignment on 32-bit platforms.
+	calls       [calibrateSteps]uint64
+	calibrating uint64
+	defaultSize uint64
+	maxSize     uint64
+	counters    poolCounters
+
+	pool  sync.Pool
+	leaks leakTracker
+
+	// MaxSize specifies the maximum capacity of buffers retained by the pool.
+	// Buffers whose capacities are greater than it will be discarded by Put
+	// method, so a huge buffer won't pin the memory. If it's not positive,
+	// there is no limit.
+	MaxSize int
+
+	// Adaptive specifies whether the pool calibrates the initial capacity
+	// of new buffers and the maximum capacity of retained buffers according
+	// to the capacities of buffers put back, which is similar to the calibration
+	// of github.com/valyala/bytebufferpool. If MaxSize is positive, it's still
+	// the upper bound of the calibrated maximum capacity.
+	Adaptive bool
+
+	// CollectStats specifies whether the pool collects usage statistics,
+	// which can be fetched by Stats method.
+	CollectStats bool
+
+	// Debug specifies whether the pool checks misuse of buffers, it should
+	// only be enabled in tests. In debug mode, the pool tracks outstanding
+	// buffers and panics on putting back a buffer which isn't outstanding
+	// (like double Put); the content of a buffer is poisoned when it's put
+	// back, and the pool panics on fetching it if it has been modified (use
+	// after Put). Buffers never put back can be reported by Leaks method.
+	Debug bool
 }
 
+const (
+	calibrateMinBits   = 6 // The smallest size class is 64 bytes.
+	calibrateSteps     = 20
+	calibrateThreshold = 42000
+	calibratePercent   = 0.95
+)
+
 // NewBufferPool creates a BufferPool instance.
 func NewBufferPool() *BufferPool {
-	return &BufferPool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return new(bytes.Buffer)
-			},
-		},
+	bp := &BufferPool{}
+	bp.pool.New = func() interface{} {
+		if bp.CollectStats {
+			atomic.AddInt64(&bp.counters.news, 1)
+		}
+		return new(bytes.Buffer)
 	}
+	return bp
 }
 
 // Get fetches a buffer from the pool.
 func (bp *BufferPool) Get() *bytes.Buffer {
-	return (bp.pool.Get()).(*bytes.Buffer)
+	return bp.get(1)
+}
+
+// get is the underlying implementation of Get method. The skip parameter is
+// the number of stack frames to ascend from the caller of get to the call site
+// recorded in debug mode, so methods wrapping it can report their callers.
+func (bp *BufferPool) get(skip int) *bytes.Buffer {
+	b := (bp.pool.Get()).(*bytes.Buffer)
+	if bp.Debug {
+		if !poisoned(b.Bytes()[:b.Cap()]) {
+			panic("BufferPool: buffer is modified after Put")
+		}
+		bp.leaks.track(b, skip+1)
+	}
+
+	if bp.Adaptive && b.Cap() == 0 {
+		if n := atomic.LoadUint64(&bp.defaultSize); n > 0 {
+			b.Grow(int(n))
+		}
+	}
+
+	if bp.CollectStats {
+		atomic.AddInt64(&bp.counters.gets, 1)
+	}
+	return b
 }
 
-// Put returns a buffer to the pool.
+// Put returns a buffer to the pool. If the capacity of the buffer exceeds
+// the limit, it will be discarded.
 func (bp *BufferPool) Put(b *bytes.Buffer) {
+	if bp.Debug && !bp.leaks.untrack(b) {
+		panic("BufferPool: put a buffer which isn't outstanding (double Put?)")
+	}
+
+	if bp.CollectStats {
+		atomic.AddInt64(&bp.counters.puts, 1)
+	}
+
+	max := bp.MaxSize
+	if bp.Adaptive {
+		if n := int(atomic.LoadUint64(&bp.maxSize)); n > 0 && (max <= 0 || n < max) {
+			max = n
+		}
+
+		// Buffers are usually drained before they're put back, so the capacity
+		// rather than the length is used to measure their sizes.
+		i := calibrateIndex(b.Cap())
+		if atomic.AddUint64(&bp.calls[i], 1) > calibrateThreshold {
+			bp.calibrate()
+		}
+	}
+
+	if max > 0 && b.Cap() > max {
+		if bp.CollectStats {
+			atomic.AddInt64(&bp.counters.discarded, 1)
+		}
+		return
+	}
+
 	b.Reset()
+	if bp.Debug {
+		poison(b.Bytes()[:b.Cap()])
+	}
 	bp.pool.Put(b)
 }
 
+// Leaks returns the call sites of Get method for buffers which haven't
+// been put back. It only works in debug mode.
+func (bp *BufferPool) Leaks() []string {
+	return bp.leaks.report()
+}
+
+// Stats returns a snapshot of the usage statistics of the pool. Cause buffers
+// might grow after they're fetched, the size of outstanding buffers isn't
+// tracked.
+func (bp *BufferPool) Stats() PoolStats {
+	return bp.counters.snapshot()
+}
+
+// GetRef fetches a buffer from the pool and wraps it into a reference-counted
+// RefBuffer, the initial reference count of which is one.
+func (bp *BufferPool) GetRef() *RefBuffer {
+	return &RefBuffer{Buffer: bp.get(1), refs: 1, pool: bp}
+}
+
+// RefBuffer is a reference-counted buffer fetched from a BufferPool. It's
+// useful when a buffer is shared by multiple goroutines, the buffer will be
+// put back to the pool when all of them have released it.
+type RefBuffer struct {
+	*bytes.Buffer
+	refs int32
+	pool *BufferPool
+}
+
+// Retain increments the reference count and returns the RefBuffer itself.
+// Retaining a released RefBuffer always panics (even if the debug mode of the
+// pool is disabled), cause the buffer might have been reused by others.
+func (rb *RefBuffer) Retain() *RefBuffer {
+	for {
+		refs := atomic.LoadInt32(&rb.refs)
+		if refs <= 0 {
+			panic("RefBuffer: retain a released buffer")
+		}
+		if atomic.CompareAndSwapInt32(&rb.refs, refs, refs+1) {
+			return rb
+		}
+	}
+}
+
+// Release decrements the reference count, the buffer is put back to the
+// pool when the count hits zero. Over-release panics in debug mode of the
+// pool, otherwise it's ignored.
+func (rb *RefBuffer) Release() {
+	switch refs := atomic.AddInt32(&rb.refs, -1); {
+	case refs == 0:
+		rb.pool.Put(rb.Buffer)
+	case refs < 0 && rb.pool.Debug:
+		panic("RefBuffer: release a released buffer")
+	}
+}
+
+// calibrate updates the initial capacity of new buffers to the most common
+// size class, and the maximum capacity of retained buffers to the size class
+// which covers the most buffers (calibratePercent).
+func (bp *BufferPool) calibrate() {
+	if !atomic.CompareAndSwapUint64(&bp.calibrating, 0, 1) {
+		return
+	}
+
+	var (
+		total uint64
+		sizes = make([]calibrateSize, 0, calibrateSteps)
+	)
+	for i := range bp.calls {
+		calls := atomic.SwapUint64(&bp.calls[i], 0)
+		total += calls
+		sizes = append(sizes, calibrateSize{calls, uint64(1) << uint(calibrateMinBits+i)})
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].calls > sizes[j].calls })
+
+	var (
+		defaultSize = sizes[0].size
+		maxSize     = defaultSize
+		sum         uint64
+		limit       = uint64(float64(total) * calibratePercent)
+	)
+	for _, s := range sizes {
+		if sum > limit {
+			break
+		}
+		sum += s.calls
+		if s.size > maxSize {
+			maxSize = s.size
+		}
+	}
+
+	atomic.StoreUint64(&bp.defaultSize, defaultSize)
+	atomic.StoreUint64(&bp.maxSize, maxSize)
+	atomic.StoreUint64(&bp.calibrating, 0)
+}
+
+// calibrateSize records the number of calls of a size class.
+type calibrateSize struct {
+	calls uint64
+	size  uint64
+}
+
+// calibrateIndex returns the index of the size class of n bytes.
+func calibrateIndex(n int) int {
+	n--
+	n >>= calibrateMinBits
+	i := 0
+	for n > 0 {
+		n >>= 1
+		i++
+	}
+	if i >= calibrateSteps {
+		i = calibrateSteps - 1
+	}
+	return i
+}
+
 // BytesPool is an implementation of httputil.BufferPool interface.
 type BytesPool struct {
-	pool sync.Pool
+	counters poolCounters // 64-bit aligned, see poolCounters.
+	pool     sync.Pool
+	size     int
+	leaks    leakTracker
+
+	// Debug specifies whether the pool panics on misuse, it should only be
+	// enabled in tests. Misuse includes putting back a byte slice whose
+	// capacity isn't equal to the configured size or whose length has been
+	// changed, and all cases checked by the debug mode of BufferPool.
+	Debug bool
+
+	// CollectStats specifies whether the pool collects usage statistics,
+	// which can be fetched by Stats method.
+	CollectStats bool
 }
 
 // NewBytesPool creates a BytesPool instance. The size parameter specifies
 // the initial size of each generated byte slice, it must be positive.
 func NewBytesPool(size int) *BytesPool {
-	return &BytesPool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return make([]byte, size)
-			},
-		},
+	bp := &BytesPool{size: size}
+	bp.pool.New = func() interface{} {
+		if bp.CollectStats {
+			atomic.AddInt64(&bp.counters.news, 1)
+		}
+
+		b := make([]byte, size)
+		if bp.Debug {
+			poison(b)
+		}
+		return b
 	}
+	return bp
 }
 
 // Get fetches a byte slice from the pool.
 func (bp *BytesPool) Get() []byte {
-	return (bp.pool.Get()).([]byte)
+	return bp.get(1)
+}
+
+// get is the underlying implementation of Get method. The skip parameter is
+// the same as the one of BufferPool.get method.
+func (bp *BytesPool) get(skip int) []byte {
+	b := (bp.pool.Get()).([]byte)
+	if bp.Debug {
+		if !poisoned(b) {
+			panic("BytesPool: byte slice is modified after Put")
+		}
+		bp.leaks.track(&b[0], skip+1)
+	}
+
+	if bp.CollectStats {
+		atomic.AddInt64(&bp.counters.gets, 1)
+	}
+	return b
 }
 
-// Put returns a byte slice to the pool. Carefully, len(b) can't be zero,
-// cause BytesPool will be used by io.CopyBuffer function.
+// Put returns a byte slice to the pool. Cause BytesPool will be used by
+// io.CopyBuffer function, len(b) can't be zero, so the length of the byte
+// slice is restored to the configured size. Byte slices whose capacities
+// aren't equal to the configured size will be dropped.
 func (bp *BytesPool) Put(b []byte) {
+	if bp.CollectStats {
+		atomic.AddInt64(&bp.counters.puts, 1)
+	}
+
+	if cap(b) != bp.size {
+		if bp.Debug {
+			panic(fmt.Sprintf("BytesPool: put a byte slice with capacity %d, expected %d", cap(b), bp.size))
+		}
+		if bp.CollectStats {
+			atomic.AddInt64(&bp.counters.discarded, 1)
+		}
+		return
+	}
+
+	if bp.Debug && len(b) != bp.size {
+		panic(fmt.Sprintf("BytesPool: put a byte slice with length %d, expected %d", len(b), bp.size))
+	}
+
+	b = b[:bp.size]
+	if bp.Debug {
+		if !bp.leaks.untrack(&b[0]) {
+			panic("BytesPool: put a byte slice which isn't outstanding (double Put?)")
+		}
+		poison(b)
+	}
 	bp.pool.Put(b)
 }
+
+// Leaks returns the call sites of Get method for byte slices which haven't
+// been put back. It only works in debug mode.
+func (bp *BytesPool) Leaks() []string {
+	return bp.leaks.report()
+}
+
+// Stats returns a snapshot of the usage statistics of the pool.
+func (bp *BytesPool) Stats() BytesPoolStats {
+	ps := bp.counters.snapshot()
+	return BytesPoolStats{ps, ps.Outstanding * int64(bp.size)}
+}
+
+// BytesPoolStats represents the usage statistics of a BytesPool.
+type BytesPoolStats struct {
+	PoolStats
+
+	// OutstandingBytes is the size (in bytes) of outstanding byte slices,
+	// which is always Outstanding multiplied by the size of byte slices.
+	OutstandingBytes int64
+}
+
+// poisonByte is used to fill the content of objects put back in debug mode.
+const poisonByte = 0xdb
+
+// poison fills the byte slice with poisonByte.
+func poison(b []byte) {
+	for i := range b {
+		b[i] = poisonByte
+	}
+}
+
+// poisoned reports whether all bytes of the byte slice are poisonByte.
+func poisoned(b []byte) bool {
+	for _, c := range b {
+		if c != poisonByte {
+			return false
+		}
+	}
+	return true
+}
+
+// leakTracker tracks outstanding objects of a pool in debug mode. Each
+// object is identified by a pointer and associated with the call site
+// which fetches it.
+type leakTracker struct {
+	locker      sync.Mutex
+	outstanding map[interface{}]string
+}
+
+// track starts tracking an object. The skip parameter is the number of stack
+// frames to ascend from the caller of track to the call site of fetching the
+// object, like the argument of runtime.Caller.
+func (lt *leakTracker) track(key interface{}, skip int) {
+	site := "unknown"
+	if pc, fn, line, ok := runtime.Caller(skip + 1); ok {
+		site = fmt.Sprintf("%s:%d %s", filepath.Base(fn), line, filepath.Base(runtime.FuncForPC(pc).Name()))
+	}
+
+	lt.locker.Lock()
+	if lt.outstanding == nil {
+		lt.outstanding = make(map[interface{}]string)
+	}
+	lt.outstanding[key] = site
+	lt.locker.Unlock()
+}
+
+// untrack stops tracking an object. If the object isn't outstanding,
+// returns false.
+func (lt *leakTracker) untrack(key interface{}) bool {
+	lt.locker.Lock()
+	defer lt.locker.Unlock()
+
+	if _, ok := lt.outstanding[key]; !ok {
+		return false
+	}
+	delete(lt.outstanding, key)
+	return true
+}
+
+// report returns the call sites of all outstanding objects.
+func (lt *leakTracker) report() []string {
+	lt.locker.Lock()
+	defer lt.locker.Unlock()
+
+	sites := make([]string, 0, len(lt.outstanding))
+	for _, site := range lt.outstanding {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+// PoolStats represents the usage statistics of a pool.
+type PoolStats struct {
+	// Gets is the number of objects fetched from the pool.
+	Gets int64
+
+	// Puts is the number of objects put back to the pool, including
+	// discarded ones.
+	Puts int64
+
+	// News is the number of objects created because the pool is empty
+	// (misses).
+	News int64
+
+	// Discarded is the number of objects which are put back but not
+	// retained by the pool, like oversize buffers.
+	Discarded int64
+
+	// Outstanding is the number of objects which are fetched but not
+	// put back yet.
+	Outstanding int64
+}
+
+// poolCounters holds counters of PoolStats, all fields are accessed atomically.
+// They must be 64-bit aligned on 32-bit platforms, which is guaranteed only for
+// the first word of an allocated struct, so a poolCounters field should be placed
+// at the beginning of the struct containing it (after other 64-bit fields).
+type poolCounters struct {
+	gets      int64
+	puts      int64
+	news      int64
+	discarded int64
+}
+
+// snapshot returns the current values of counters.
+func (pc *poolCounters) snapshot() PoolStats {
+	ps := PoolStats{
+		Gets:      atomic.LoadInt64(&pc.gets),
+		Puts:      atomic.LoadInt64(&pc.puts),
+		News:      atomic.LoadInt64(&pc.news),
+		Discarded: atomic.LoadInt64(&pc.discarded),
+	}
+	// It can be negative if objects which don't come from the pool are put
+	// back, the value isn't clamped so that the misuse can be noticed.
+	ps.Outstanding = ps.Gets - ps.Puts
+	return ps
+}
+
+// SizedBytesPool is a byte slice pool with power-of-two size classes. Compared
+// with BytesPool, it's suitable for byte slices whose sizes vary widely.
+type SizedBytesPool struct {
+	min   int // The size of the smallest class.
+	max   int // The size of the largest class.
+	pools []sync.Pool
+}
+
+// NewSizedBytesPool creates a SizedBytesPool instance. The min and max
+// parameters specify the sizes of the smallest and the largest classes,
+// they will be rounded up to powers of two. min must be positive and
+// can't be greater than max.
+func NewSizedBytesPool(min, max int) *SizedBytesPool {
+	min, max = roundPow2(min), roundPow2(max)
+
+	sp := &SizedBytesPool{
+		min:   min,
+		max:   max,
+		pools: make([]sync.Pool, bits.Len(uint(max))-bits.Len(uint(min))+1),
+	}
+
+	for i := range sp.pools {
+		size := min << uint(i)
+		sp.pools[i].New = func() interface{} {
+			return make([]byte, size)
+		}
+	}
+	return sp
+}
+
+// Get fetches a byte slice whose length is n from the pool, and its capacity
+// is the size of the smallest class which can hold n bytes. If n is greater
+// than the size of the largest class, a new byte slice will be allocated.
+func (sp *SizedBytesPool) Get(n int) []byte {
+	if n > sp.max {
+		return make([]byte, n)
+	}
+	return (sp.pools[sp.class(n)].Get()).([]byte)[:n]
+}
+
+// Put returns a byte slice to the pool of its class. Byte slices whose
+// capacities aren't equal to the size of any class will be dropped.
+func (sp *SizedBytesPool) Put(b []byte) {
+	c := cap(b)
+	if c < sp.min || c > sp.max || c&(c-1) != 0 {
+		return
+	}
+	sp.pools[sp.class(c)].Put(b[:c])
+}
+
+// class returns the index of the smallest class which can hold n bytes.
+func (sp *SizedBytesPool) class(n int) int {
+	if n <= sp.min {
+		return 0
+	}
+	return bits.Len(uint(n-1)) - bits.Len(uint(sp.min)) + 1
+}
+
+// roundPow2 rounds n up to a power of two.
+func roundPow2(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << uint(bits.Len(uint(n-1)))
+}
@@ -3,7 +3,7 @@
 // Author: blinklv <blinklv@icloud.com>
 // Create Time: 2020-06-18
 // Maintainer: blinklv <blinklv@icloud.com>
-// Last Change: 2020-06-18
+// Last Change: 2026-10-19
 
 package util
 
@@ -13,6 +13,7 @@ import (
 	"io"
 	"math/rand"
 	"net/http/httputil"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -97,3 +98,305 @@ type trivialWriter struct {
 func (tw *trivialWriter) Write(b []byte) (int, error) {
 	return tw.w.Write(b)
 }
+
+func TestSizedBytesPool(t *testing.T) {
+	sp := NewSizedBytesPool(500, 4<<20)
+
+	for _, cs := range []struct {
+		N   int `json:"n"`
+		Cap int `json:"cap"`
+	}{
+		{0, 512},
+		{1, 512},
+		{512, 512},
+		{513, 1024},
+		{4000, 4096},
+		{4096, 4096},
+		{1 << 20, 1 << 20},
+		{4 << 20, 4 << 20},
+		{4<<20 + 1, 4<<20 + 1},
+	} {
+		t.Run(encodeCase(cs), func(t *testing.T) {
+			b := sp.Get(cs.N)
+			assert.Equal(t, cs.N, len(b))
+			assert.Equal(t, cs.Cap, cap(b))
+			sp.Put(b)
+		})
+	}
+
+	// Byte slices of foreign sizes are dropped.
+	sp.Put(make([]byte, 1000))
+	sp.Put(make([]byte, 256))
+	sp.Put(make([]byte, 8<<20))
+	for i := 0; i < 100; i++ {
+		b := sp.Get(1000)
+		assert.Equal(t, 1024, cap(b))
+		sp.Put(b)
+	}
+}
+
+func TestBufferPoolMaxSize(t *testing.T) {
+	bp := NewBufferPool()
+	bp.MaxSize = 1024
+
+	// Buffers whose capacities exceed the limit are discarded.
+	huge := bp.Get()
+	huge.Grow(1 << 20)
+	bp.Put(huge)
+	for i := 0; i < 100; i++ {
+		b := bp.Get()
+		assert.True(t, b.Cap() <= 1024)
+		assert.True(t, b != huge)
+		bp.Put(b)
+	}
+}
+
+func TestBufferPoolAdaptive(t *testing.T) {
+	bp := NewBufferPool()
+	bp.Adaptive = true
+
+	data := make([]byte, 3000)
+	for i := 0; i < calibrateThreshold+1; i++ {
+		b := bp.Get()
+		b.Write(data)
+		bp.Put(b)
+	}
+	assert.Equal(t, uint64(4096), atomic.LoadUint64(&bp.defaultSize))
+	assert.Equal(t, uint64(4096), atomic.LoadUint64(&bp.maxSize))
+
+	// Buffers drained before Put are calibrated by their capacities.
+	dp := NewBufferPool()
+	dp.Adaptive = true
+	dp.CollectStats = true
+	for i := 0; i < calibrateThreshold+1; i++ {
+		b := dp.Get()
+		b.Write(data)
+		b.WriteTo(io.Discard)
+		dp.Put(b)
+	}
+	assert.Equal(t, uint64(4096), atomic.LoadUint64(&dp.defaultSize))
+	assert.Equal(t, uint64(4096), atomic.LoadUint64(&dp.maxSize))
+
+	stats := dp.Stats()
+	for i := 0; i < 100; i++ {
+		b := dp.Get()
+		b.Write(data)
+		b.WriteTo(io.Discard)
+		dp.Put(b)
+	}
+	assert.Equal(t, stats.Discarded, dp.Stats().Discarded)
+
+	// New buffers are preallocated with the calibrated size.
+	np := NewBufferPool()
+	np.Adaptive = true
+	atomic.StoreUint64(&np.defaultSize, 4096)
+	assert.True(t, np.Get().Cap() >= 4096)
+
+	// Buffers exceeding the calibrated maximum capacity are discarded.
+	huge := bp.Get()
+	huge.Grow(1 << 20)
+	bp.Put(huge)
+	for i := 0; i < 100; i++ {
+		b := bp.Get()
+		assert.True(t, b != huge)
+		bp.Put(b)
+	}
+}
+
+func TestBytesPoolPut(t *testing.T) {
+	bp := NewBytesPool(4096)
+
+	// 1. Check the length of a re-sliced byte slice is restored.
+	b := bp.Get()
+	bp.Put(b[:0])
+	for i := 0; i < 100; i++ {
+		b = bp.Get()
+		assert.Equal(t, 4096, len(b))
+		bp.Put(b[:10])
+	}
+
+	// 2. Check byte slices of wrong sizes are dropped.
+	bp.Put(make([]byte, 1024))
+	bp.Put(make([]byte, 0, 8192))
+	for i := 0; i < 100; i++ {
+		b = bp.Get()
+		assert.Equal(t, 4096, len(b))
+		assert.Equal(t, 4096, cap(b))
+		bp.Put(b)
+	}
+
+	// 3. Check the debug mode.
+	bp.Debug = true
+	assert.Panics(t, func() { bp.Put(make([]byte, 1024)) })
+	assert.Panics(t, func() { bp.Put(bp.Get()[:0]) })
+	assert.NotPanics(t, func() { bp.Put(bp.Get()) })
+}
+
+func TestPoolStats(t *testing.T) {
+	// 1. Check BufferPool statistics.
+	bp := NewBufferPool()
+	bp.CollectStats = true
+	bp.MaxSize = 1024
+
+	b1, b2 := bp.Get(), bp.Get()
+	b1.Grow(512)
+	b2.Grow(4096)
+	stats := bp.Stats()
+	assert.Equal(t, int64(2), stats.Gets)
+	assert.Equal(t, int64(2), stats.News)
+	assert.Equal(t, int64(2), stats.Outstanding)
+
+	bp.Put(b1)
+	bp.Put(b2)
+	stats = bp.Stats()
+	assert.Equal(t, int64(2), stats.Puts)
+	assert.Equal(t, int64(1), stats.Discarded)
+	assert.Equal(t, int64(0), stats.Outstanding)
+
+	// 2. Check BytesPool statistics.
+	sp := NewBytesPool(64)
+	sp.CollectStats = true
+
+	b := sp.Get()
+	bstats := sp.Stats()
+	assert.Equal(t, int64(1), bstats.Gets)
+	assert.Equal(t, int64(1), bstats.News)
+	assert.Equal(t, int64(1), bstats.Outstanding)
+	assert.Equal(t, int64(64), bstats.OutstandingBytes)
+
+	sp.Put(b)
+	bstats = sp.Stats()
+	assert.Equal(t, int64(0), bstats.Outstanding)
+	assert.Equal(t, int64(0), bstats.OutstandingBytes)
+
+	// Byte slices with wrong capacities (including re-sliced ones from the
+	// pool) are discarded, both counters agree and the misuse isn't hidden.
+	b = sp.Get()
+	sp.Put(b[8:])
+	bstats = sp.Stats()
+	assert.Equal(t, int64(1), bstats.Discarded)
+	assert.Equal(t, int64(0), bstats.Outstanding)
+	assert.Equal(t, int64(0), bstats.OutstandingBytes)
+
+	sp.Put(make([]byte, 100))
+	bstats = sp.Stats()
+	assert.Equal(t, int64(3), bstats.Puts)
+	assert.Equal(t, int64(2), bstats.Discarded)
+	assert.Equal(t, int64(-1), bstats.Outstanding)
+	assert.Equal(t, int64(-64), bstats.OutstandingBytes)
+
+	// 3. Check statistics aren't collected by default.
+	sp = NewBytesPool(4096)
+	sp.Put(sp.Get())
+	assert.Equal(t, BytesPoolStats{}, sp.Stats())
+}
+
+func TestPoolDebug(t *testing.T) {
+	// 1. Check BufferPool.
+	bp := NewBufferPool()
+	bp.Debug = true
+
+	b1, b2 := bp.Get(), bp.Get()
+	b1.WriteString("Hello, World!")
+	assert.Equal(t, 2, len(bp.Leaks()))
+	assert.Contains(t, bp.Leaks()[0], "bpool_test.go")
+
+	bp.Put(b1)
+	assert.Equal(t, 1, len(bp.Leaks()))
+	assert.Panics(t, func() { bp.Put(b1) }) // Double Put.
+	assert.Panics(t, func() { bp.Put(&bytes.Buffer{}) })
+	bp.Put(b2)
+	assert.Empty(t, bp.Leaks())
+
+	// Use after Put. sync.Pool might drop the buffer, so try it several times.
+	assert.True(t, retryPanics(func() {
+		b := bp.Get()
+		b.WriteString("Hello, World!")
+		bp.Put(b)
+		b.Bytes()[:1][0] = 'X'
+	}, func() {
+		bp.Put(bp.Get())
+	}))
+
+	// 2. Check BytesPool.
+	sp := NewBytesPool(64)
+	sp.Debug = true
+
+	s := sp.Get()
+	assert.Equal(t, 1, len(sp.Leaks()))
+	sp.Put(s)
+	assert.Empty(t, sp.Leaks())
+	assert.Panics(t, func() { sp.Put(s) })
+
+	// Use after Put.
+	assert.True(t, retryPanics(func() {
+		s := sp.Get()
+		sp.Put(s)
+		s[10] = 'X'
+	}, func() {
+		sp.Put(sp.Get())
+	}))
+}
+
+// retryPanics calls the prepare function and then the check function until
+// the check function panics. If it never panics in 100 times, returns false.
+func retryPanics(prepare, check func()) bool {
+	for i := 0; i < 100; i++ {
+		prepare()
+		if func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			check()
+			return
+		}() {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRefBuffer(t *testing.T) {
+	bp := NewBufferPool()
+	bp.Debug = true
+
+	rb := bp.GetRef()
+	rb.WriteString("Hello, World!")
+
+	var (
+		g   = &Group{}
+		out = make([]string, 3)
+	)
+	for i := 0; i < 3; i++ {
+		i, rb := i, rb.Retain()
+		g.Go(func() interface{} {
+			defer rb.Release()
+			out[i] = rb.String()
+			return nil
+		})
+	}
+	rb.Release()
+	assert.Nil(t, g.Result())
+	assert.Equal(t, []string{"Hello, World!", "Hello, World!", "Hello, World!"}, out)
+
+	// The buffer has been put back to the pool.
+	assert.Empty(t, bp.Leaks())
+	assert.Panics(t, func() { rb.Release() })
+	assert.Panics(t, func() { rb.Retain() })
+
+	// Over-release is ignored when the debug mode is disabled.
+	bp = NewBufferPool()
+	rb = bp.GetRef()
+	rb.Release()
+	assert.NotPanics(t, func() { rb.Release() })
+
+	// But retaining a released buffer always panics.
+	assert.Panics(t, func() { rb.Retain() })
+
+	// Leaks are reported at the call site of GetRef.
+	bp = NewBufferPool()
+	bp.Debug = true
+	rb = bp.GetRef()
+	assert.Equal(t, 1, len(bp.Leaks()))
+	assert.Contains(t, bp.Leaks()[0], "bpool_test.go")
+	rb.Release()
+	assert.Empty(t, bp.Leaks())
+}
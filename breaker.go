@@ -0,0 +1,339 @@
+// breaker.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is returned when the CircuitBreaker is open.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// ErrTooManyProbes is returned when the CircuitBreaker is half-open and
+	// the number of in-flight probes has reached the limit.
+	ErrTooManyProbes = errors.New("circuit breaker is half-open, too many probes")
+)
+
+// BreakerState represents the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// StateClosed means requests are allowed.
+	StateClosed BreakerState = iota
+
+	// StateOpen means requests are rejected.
+	StateOpen
+
+	// StateHalfOpen means a limited number of requests (probes) are allowed
+	// to check whether the downstream has recovered.
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breakerChange represents a state change of CircuitBreaker.
+type breakerChange struct {
+	from, to BreakerState
+}
+
+// breakerBuckets is the number of buckets in the rolling window.
+const breakerBuckets = 10
+
+// breakerBucket counts requests in a slice of the rolling window.
+type breakerBucket struct {
+	index    int64
+	requests int
+	failures int
+}
+
+// CircuitBreaker is a circuit breaker for outbound calls. It's closed at
+// first; when the failure ratio over the rolling window reaches the limit,
+// it opens and rejects all requests. After the open timeout, it becomes
+// half-open and allows a limited number of probes; it closes if all probes
+// succeed, otherwise it opens again. The zero value is ready to use.
+type CircuitBreaker struct {
+	locker     sync.Mutex
+	state      BreakerState
+	generation uint64
+	buckets    [breakerBuckets]breakerBucket
+	openedAt   time.Time
+	probes     int
+	successes  int
+	changes    []breakerChange // State changes haven't been notified.
+
+	// FailureRatio specifies the failure ratio over the rolling window at
+	// which the breaker opens. If it's not positive, 0.5 will be used.
+	FailureRatio float64
+
+	// MinRequests specifies the minimum number of requests over the rolling
+	// window before the breaker can open. If it's not positive, 10 will be used.
+	MinRequests int
+
+	// Window specifies the duration of the rolling window. If it's not
+	// positive, 10 seconds will be used.
+	Window time.Duration
+
+	// OpenTimeout specifies how long the breaker stays open before it becomes
+	// half-open. If it's not positive, 30 seconds will be used.
+	OpenTimeout time.Duration
+
+	// HalfOpenProbes specifies the number of probes allowed when the breaker
+	// is half-open, all of them must succeed to close the breaker. If it's
+	// not positive, 1 will be used.
+	HalfOpenProbes int
+
+	// IsFailure specifies an optional predicate which reports whether the
+	// error of a request is a failure. It's only called for non-nil errors,
+	// successful requests are never failures. If it's nil, all non-nil errors
+	// are failures except the ones whose type is *util.Error and whose code
+	// is in [400, 500), which are considered as client errors like HTTP 4xx.
+	IsFailure func(err error) bool
+
+	// OnStateChange specifies an optional hook which is called when the
+	// state of the breaker changes.
+	OnStateChange func(from, to BreakerState)
+
+	// Clock specifies an optional clock used by the breaker. If it's nil,
+	// the system clock will be used.
+	Clock Clock
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.locker.Lock()
+	state := cb.current(getClock(cb.Clock).Now())
+	changes := cb.flush()
+	cb.locker.Unlock()
+
+	cb.notify(changes)
+	return state
+}
+
+// Execute calls the function if the breaker allows, and records its result.
+// If the breaker rejects the request, returns ErrCircuitOpen or ErrTooManyProbes.
+// If the function panics, it's recorded as a failure and the panic goes on.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	done, err := cb.Allow()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if x := recover(); x != nil {
+			done(fmt.Errorf("panic: %v", x))
+			panic(x)
+		}
+	}()
+
+	err = fn()
+	done(err)
+	return err
+}
+
+// Allow checks whether a request is allowed. If so, the caller must call the
+// returned done function exactly once with the result of the request.
+func (cb *CircuitBreaker) Allow() (done func(err error), err error) {
+	cb.locker.Lock()
+	switch cb.current(getClock(cb.Clock).Now()) {
+	case StateOpen:
+		err = ErrCircuitOpen
+	case StateHalfOpen:
+		if cb.probes >= positive(cb.HalfOpenProbes, 1) {
+			err = ErrTooManyProbes
+		} else {
+			cb.probes++
+		}
+	}
+	generation := cb.generation
+	changes := cb.flush()
+	cb.locker.Unlock()
+
+	cb.notify(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { cb.record(generation, err) })
+	}, nil
+}
+
+// record records the result of a request.
+func (cb *CircuitBreaker) record(generation uint64, err error) {
+	failure := cb.isFailure(err)
+
+	cb.locker.Lock()
+	defer func() {
+		changes := cb.flush()
+		cb.locker.Unlock()
+		cb.notify(changes)
+	}()
+
+	now := getClock(cb.Clock).Now()
+	state := cb.current(now)
+
+	// The state has changed since the request was allowed, so its result
+	// is outdated.
+	if generation != cb.generation {
+		return
+	}
+
+	switch state {
+	case StateClosed:
+		b := cb.bucket(now)
+		b.requests++
+		if failure {
+			b.failures++
+		}
+
+		requests, failures := cb.sum(now)
+		if requests >= positive(cb.MinRequests, 10) &&
+			float64(failures) >= float64(requests)*positiveFloat(cb.FailureRatio, 0.5) {
+			cb.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failure {
+			cb.setState(StateOpen, now)
+		} else if cb.successes++; cb.successes >= positive(cb.HalfOpenProbes, 1) {
+			cb.setState(StateClosed, now)
+		}
+	}
+}
+
+// current returns the current state, the open breaker becomes half-open if
+// the open timeout has elapsed.
+func (cb *CircuitBreaker) current(now time.Time) BreakerState {
+	if cb.state == StateOpen && now.Sub(cb.openedAt) >= positiveDuration(cb.OpenTimeout, 30*time.Second) {
+		cb.setState(StateHalfOpen, now)
+	}
+	return cb.state
+}
+
+// setState changes the state and resets counters.
+func (cb *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	cb.changes = append(cb.changes, breakerChange{cb.state, state})
+	cb.state = state
+	cb.generation++
+	cb.probes, cb.successes = 0, 0
+	cb.buckets = [breakerBuckets]breakerBucket{}
+	if state == StateOpen {
+		cb.openedAt = now
+	}
+}
+
+// flush returns state changes which haven't been notified and clears them.
+func (cb *CircuitBreaker) flush() []breakerChange {
+	changes := cb.changes
+	cb.changes = nil
+	return changes
+}
+
+// notify calls OnStateChange hook for each state change. It shouldn't be
+// called when the locker is held, cause the hook might call methods of
+// the breaker.
+func (cb *CircuitBreaker) notify(changes []breakerChange) {
+	if cb.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		cb.OnStateChange(c.from, c.to)
+	}
+}
+
+// width returns the duration of each bucket.
+func (cb *CircuitBreaker) width() int64 {
+	w := int64(positiveDuration(cb.Window, 10*time.Second)) / breakerBuckets
+	if w <= 0 {
+		w = 1
+	}
+	return w
+}
+
+// bucket returns the bucket of the current time, it's reset if outdated.
+func (cb *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	index := now.UnixNano() / cb.width()
+	b := &cb.buckets[index%breakerBuckets]
+	if b.index != index {
+		*b = breakerBucket{index: index}
+	}
+	return b
+}
+
+// sum returns the number of requests and failures over the rolling window.
+func (cb *CircuitBreaker) sum(now time.Time) (requests, failures int) {
+	index := now.UnixNano() / cb.width()
+	for _, b := range cb.buckets {
+		if index-b.index < breakerBuckets {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return
+}
+
+// isFailure reports whether the error is a failure.
+func (cb *CircuitBreaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if cb.IsFailure != nil {
+		return cb.IsFailure(err)
+	}
+
+	return !isClientError(err)
+}
+
+// isClientError reports whether the error is a *util.Error whose code is in
+// [400, 500). Like HTTP 4xx status codes, these errors are caused by the caller,
+// so they're not considered as failures of the callee.
+func isClientError(err error) bool {
+	var ue *Error
+	return errors.As(err, &ue) && ue.Code >= 400 && ue.Code < 500
+}
+
+// positive returns n if it's positive, otherwise returns the default value.
+func positive(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// positiveFloat returns f if it's positive, otherwise returns the default value.
+func positiveFloat(f, def float64) float64 {
+	if f > 0 {
+		return f
+	}
+	return def
+}
+
+// positiveDuration returns d if it's positive, otherwise returns the default value.
+func positiveDuration(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,129 @@
+// breaker_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		clock   = newFakeClock()
+		changes []string
+		cb      = &CircuitBreaker{
+			FailureRatio:   0.5,
+			MinRequests:    4,
+			Window:         10 * time.Second,
+			OpenTimeout:    time.Minute,
+			HalfOpenProbes: 2,
+			Clock:          clock,
+		}
+		failed = errors.New("failed")
+	)
+	cb.OnStateChange = func(from, to BreakerState) {
+		changes = append(changes, fmt.Sprintf("%s->%s", from, to))
+	}
+
+	succeed := func() error { return nil }
+	fail := func() error { return failed }
+
+	// 1. Check client errors don't trip the breaker.
+	for i := 0; i < 10; i++ {
+		assert.Error(t, cb.Execute(func() error { return Errorf(404, "not found") }))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+
+	// 2. Check the minimum request volume.
+	assert.Equal(t, failed, cb.Execute(fail))
+	assert.Equal(t, failed, cb.Execute(fail))
+	clock.Advance(10 * time.Second) // Old requests are out of the window.
+	assert.Equal(t, failed, cb.Execute(fail))
+	assert.NoError(t, cb.Execute(succeed))
+	assert.NoError(t, cb.Execute(succeed))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// 3. Check the failure ratio.
+	assert.Equal(t, failed, cb.Execute(fail))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, ErrCircuitOpen, cb.Execute(succeed))
+
+	// 4. Check the half-open state reopens after a failed probe.
+	clock.Advance(time.Minute)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, failed, cb.Execute(fail))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// 5. Check the half-open state closes after all probes succeed.
+	clock.Advance(time.Minute)
+	done1, err := cb.Allow()
+	assert.NoError(t, err)
+	done2, err := cb.Allow()
+	assert.NoError(t, err)
+	_, err = cb.Allow()
+	assert.Equal(t, ErrTooManyProbes, err)
+	done1(nil)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	done2(nil)
+	assert.Equal(t, StateClosed, cb.State())
+
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}, changes)
+}
+
+func TestCircuitBreakerPanic(t *testing.T) {
+	cb := &CircuitBreaker{MinRequests: 1, Clock: newFakeClock()}
+	assert.Panics(t, func() {
+		cb.Execute(func() error { panic("oops") })
+	})
+	assert.Equal(t, StateOpen, cb.State())
+
+	// The zero value is ready to use.
+	cb = &CircuitBreaker{}
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestCircuitBreakerIsFailure(t *testing.T) {
+	var (
+		ignored = errors.New("ignored")
+		cb      = &CircuitBreaker{
+			MinRequests: 2,
+			Clock:       newFakeClock(),
+			// The predicate doesn't handle nil errors.
+			IsFailure: func(err error) bool { return !errors.Is(err, ignored) },
+		}
+	)
+
+	// 1. Check successful requests aren't passed to the predicate.
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, cb.Execute(func() error { return nil }))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+
+	// 2. Check errors are classified by the predicate.
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, ignored, cb.Execute(func() error { return ignored }))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+
+	failed := errors.New("failed")
+	for i := 0; i < 10; i++ {
+		cb.Execute(func() error { return failed })
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
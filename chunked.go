@@ -0,0 +1,203 @@
+// chunked.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import "io"
+
+// ChunkedBuffer is a variable-sized buffer which consists of fixed-size
+// chunks fetched from a BytesPool. Compared with bytes.Buffer, it never
+// reallocates and copies data when it grows, so it's suitable for large
+// payloads. Chunks are put back to the pool once they have been read.
+type ChunkedBuffer struct {
+	pool   *BytesPool
+	chunks [][]byte
+	off    int // Read offset in the first chunk.
+	n      int // Write offset in the last chunk.
+}
+
+// NewChunkedBuffer creates a ChunkedBuffer instance. The size of each chunk
+// is the size of byte slices in the pool.
+func NewChunkedBuffer(pool *BytesPool) *ChunkedBuffer {
+	return &ChunkedBuffer{pool: pool}
+}
+
+// Len returns the number of bytes of the unread portion of the buffer.
+func (cb *ChunkedBuffer) Len() int {
+	switch len(cb.chunks) {
+	case 0:
+		return 0
+	case 1:
+		return cb.n - cb.off
+	default:
+		return len(cb.chunks[0]) - cb.off + (len(cb.chunks)-2)*cb.pool.size + cb.n
+	}
+}
+
+// Write appends the contents of p to the buffer. The return error is always nil.
+func (cb *ChunkedBuffer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		tail := cb.tail(1)
+		m := copy(tail, p)
+		cb.n += m
+		written += m
+		p = p[m:]
+	}
+	return written, nil
+}
+
+// WriteString appends the contents of s to the buffer. The return error is always nil.
+func (cb *ChunkedBuffer) WriteString(s string) (int, error) {
+	written := 0
+	for len(s) > 0 {
+		tail := cb.tail(1)
+		m := copy(tail, s)
+		cb.n += m
+		written += m
+		s = s[m:]
+	}
+	return written, nil
+}
+
+// Read reads the next len(p) bytes from the buffer or until the buffer is
+// drained. If the buffer has no data to return, err is io.EOF (unless len(p)
+// is zero).
+func (cb *ChunkedBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if cb.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for len(p) > 0 {
+		head := cb.head()
+		if len(head) == 0 {
+			break
+		}
+		m := copy(p, head)
+		cb.advance(m)
+		read += m
+		p = p[m:]
+	}
+	return read, nil
+}
+
+// ReadFrom reads data from r until EOF and appends it to the buffer. The
+// return value n is the number of bytes read. Any error except io.EOF
+// encountered during the read is also returned.
+func (cb *ChunkedBuffer) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	for {
+		tail := cb.tail(1)
+		m, err := r.Read(tail)
+		if m < 0 {
+			panic("ChunkedBuffer: reader returned negative count from Read")
+		}
+
+		cb.n += m
+		n += int64(m)
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// WriteTo writes data to w until the buffer is drained or an error occurs.
+// The return value n is the number of bytes written.
+func (cb *ChunkedBuffer) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for {
+		head := cb.head()
+		if len(head) == 0 {
+			return n, nil
+		}
+
+		m, err := w.Write(head)
+		if m > len(head) {
+			panic("ChunkedBuffer: invalid Write count")
+		}
+
+		cb.advance(m)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+
+		if m != len(head) {
+			return n, io.ErrShortWrite
+		}
+	}
+}
+
+// Reset resets the buffer to be empty. All chunks except the first one are
+// put back to the pool, the first one will be reused by later writes.
+func (cb *ChunkedBuffer) Reset() {
+	if len(cb.chunks) == 0 {
+		return
+	}
+
+	for _, chunk := range cb.chunks[1:] {
+		cb.pool.Put(chunk)
+	}
+	cb.chunks = cb.chunks[:1]
+	cb.off, cb.n = 0, 0
+}
+
+// Release resets the buffer to be empty and puts all chunks back to the pool.
+func (cb *ChunkedBuffer) Release() {
+	for _, chunk := range cb.chunks {
+		cb.pool.Put(chunk)
+	}
+	cb.chunks = nil
+	cb.off, cb.n = 0, 0
+}
+
+// head returns the unread portion of the first chunk.
+func (cb *ChunkedBuffer) head() []byte {
+	switch len(cb.chunks) {
+	case 0:
+		return nil
+	case 1:
+		return cb.chunks[0][cb.off:cb.n]
+	default:
+		return cb.chunks[0][cb.off:]
+	}
+}
+
+// advance marks k bytes of the first chunk as read. If the first chunk has
+// been drained, it will be put back to the pool unless it's the only one.
+func (cb *ChunkedBuffer) advance(k int) {
+	cb.off += k
+	if len(cb.chunks) == 1 {
+		if cb.off == cb.n {
+			cb.off, cb.n = 0, 0
+		}
+	} else if cb.off == len(cb.chunks[0]) {
+		cb.pool.Put(cb.chunks[0])
+		cb.chunks[0] = nil
+		cb.chunks = cb.chunks[1:]
+		cb.off = 0
+	}
+}
+
+// tail returns the free space of the last chunk, a new chunk will be fetched
+// from the pool if the last one is full. The skip parameter is the number of
+// stack frames to ascend from the caller of tail to the call site recorded
+// by the debug mode of the pool.
+func (cb *ChunkedBuffer) tail(skip int) []byte {
+	if len(cb.chunks) == 0 || cb.n == len(cb.chunks[len(cb.chunks)-1]) {
+		cb.chunks = append(cb.chunks, cb.pool.get(skip+1))
+		cb.n = 0
+	}
+	return cb.chunks[len(cb.chunks)-1][cb.n:]
+}
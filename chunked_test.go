@@ -0,0 +1,123 @@
+// chunked_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedBuffer(t *testing.T) {
+	bp := NewBytesPool(64)
+	bp.Debug = true
+
+	for _, size := range []int{0, 1, 63, 64, 65, 1000, 4096} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		// 1. Check Write and Read.
+		cb := NewChunkedBuffer(bp)
+		for i := 0; i < len(data); i += 7 {
+			end := i + 7
+			if end > len(data) {
+				end = len(data)
+			}
+			cb.Write(data[i:end])
+		}
+		assert.Equal(t, size, cb.Len())
+
+		out := &bytes.Buffer{}
+		p := make([]byte, 10)
+		for {
+			n, err := cb.Read(p)
+			out.Write(p[:n])
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, string(data), out.String())
+		assert.Equal(t, 0, cb.Len())
+
+		// 2. Check ReadFrom and WriteTo.
+		n, err := cb.ReadFrom(&trivialReader{bytes.NewReader(data)})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), n)
+		cb.WriteString("tail")
+		assert.Equal(t, size+4, cb.Len())
+
+		out.Reset()
+		n, err = cb.WriteTo(&trivialWriter{out})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size+4), n)
+		assert.Equal(t, string(data)+"tail", out.String())
+		assert.Equal(t, 0, cb.Len())
+
+		// 3. Check io.Copy uses ReaderFrom and WriterTo.
+		cb.Write(data)
+		out.Reset()
+		_, err = io.Copy(out, cb)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), out.String())
+
+		// 4. Check Reset and Release.
+		cb.Write(data)
+		cb.Reset()
+		assert.Equal(t, 0, cb.Len())
+		assert.True(t, len(bp.Leaks()) <= 1)
+
+		cb.Write(data)
+		cb.Release()
+		assert.Equal(t, 0, cb.Len())
+		assert.Empty(t, bp.Leaks())
+	}
+}
+
+func TestChunkedBufferLeaks(t *testing.T) {
+	bp := NewBytesPool(64)
+	bp.Debug = true
+
+	// Leaked chunks are reported at the call sites of ChunkedBuffer methods.
+	cb := NewChunkedBuffer(bp)
+	cb.Write(make([]byte, 100))
+	cb.WriteString("foo")
+	cb.ReadFrom(bytes.NewReader(make([]byte, 100)))
+	leaks := bp.Leaks()
+	assert.Equal(t, 4, len(leaks))
+	for _, leak := range leaks {
+		assert.Contains(t, leak, "chunked_test.go")
+	}
+	cb.Release()
+	assert.Empty(t, bp.Leaks())
+}
+
+func TestChunkedBufferShortWrite(t *testing.T) {
+	cb := NewChunkedBuffer(NewBytesPool(64))
+	cb.Write(make([]byte, 100))
+
+	n, err := cb.WriteTo(&limitedWriter{10})
+	assert.Equal(t, io.ErrShortWrite, err)
+	assert.Equal(t, int64(10), n)
+	assert.Equal(t, 90, cb.Len())
+}
+
+// limitedWriter writes at most n bytes each time without returning an error.
+type limitedWriter struct {
+	n int
+}
+
+func (lw *limitedWriter) Write(b []byte) (int, error) {
+	if len(b) > lw.n {
+		return lw.n, nil
+	}
+	return len(b), nil
+}
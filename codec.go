@@ -3,18 +3,33 @@
 // Author: blinklv <blinklv@icloud.com>
 // Create Time: 2020-05-08
 // Maintainer: blinklv <blinklv@icloud.com>
-// Last Change: 2020-05-08
+// Last Change: 2026-10-19
 
 package util
 
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
 )
 
+// JsonErrorHandler specifies an optional function which is called when
+// ToJson, ToPrettyJson or AppendJson fails to encode a value, cause these
+// functions don't return error. It should be set before these functions
+// are called, usually in the init stage of a program.
+var JsonErrorHandler func(v interface{}, err error)
+
 // ToJson returns the JSON encoding of v. Compared with json.Marshal,
 // it won't escape special characters (&, <, and >) in quoted strings
-// to avoid certain safety problems, and doesn't return error.
+// to avoid certain safety problems, and doesn't return error. If v
+// can't be encoded, returns nil and calls JsonErrorHandler.
 func ToJson(v interface{}) []byte {
 	return toJson(v, false, "")
 }
@@ -25,26 +40,512 @@ func ToPrettyJson(v interface{}) []byte {
 	return toJson(v, false, "\t")
 }
 
+// MarshalJson is the same as ToJson except for it returns the error
+// when v can't be encoded.
+func MarshalJson(v interface{}) ([]byte, error) {
+	return JsonEncodeOptions{}.Marshal(v)
+}
+
+// MarshalPrettyJson is the same as ToPrettyJson except for it returns
+// the error when v can't be encoded.
+func MarshalPrettyJson(v interface{}) ([]byte, error) {
+	return JsonEncodeOptions{Indent: "\t"}.Marshal(v)
+}
+
+// jsonBufferPool is used by JsonLinesWriter to buffer records. Huge buffers
+// won't be retained.
+var jsonBufferPool = func() *BufferPool {
+	bp := NewBufferPool()
+	bp.MaxSize = jsonMaxPooledSize
+	return bp
+}()
+
+// jsonMaxPooledSize is the maximum capacity of buffers retained by pools of
+// JSON encoding.
+const jsonMaxPooledSize = 64 * 1024
+
+// jsonEncoder is a json.Encoder with the buffer it writes to, they're pooled
+// together, so neither of them is allocated for each encoding.
+type jsonEncoder struct {
+	buf *bytes.Buffer
+	enc *json.Encoder
+}
+
+// jsonEncoderPool is used by all JSON encoding functions. Encoders whose
+// buffers are huge won't be retained.
+var jsonEncoderPool = func() *Pool[*jsonEncoder] {
+	p := NewPool(func() *jsonEncoder {
+		buf := &bytes.Buffer{}
+		return &jsonEncoder{buf: buf, enc: json.NewEncoder(buf)}
+	})
+	p.Valid = func(e *jsonEncoder) bool { return e.buf.Cap() <= jsonMaxPooledSize }
+	p.Reset = func(e *jsonEncoder) { e.buf.Reset() }
+	return p
+}()
+
+// AppendJson appends the JSON encoding of v to dst and returns the extended
+// byte slice. It's the same as ToJson except for the JSON encoding is built
+// by a pooled encoder (including its buffer) and then appended to dst, so
+// neither the encoder nor an intermediate buffer is allocated. Allocations
+// inside encoding/json (like sorting map keys) still happen. If v can't be
+// encoded, dst will be returned unchanged.
+func AppendJson(dst []byte, v interface{}) []byte {
+	e, err := encodeJson(v, JsonEncodeOptions{})
+	if err != nil {
+		handleJsonError(v, err)
+		return dst
+	}
+	defer jsonEncoderPool.Put(e)
+	return append(dst, e.buf.Bytes()...)
+}
+
+// ToJsonWriter writes the JSON encoding of v to w, which is the same as the
+// output of ToJson. The JSON encoding is built by a pooled encoder at first,
+// so nothing will be written to w if v can't be encoded.
+func ToJsonWriter(w io.Writer, v interface{}) error {
+	return JsonEncodeOptions{}.Encode(w, v)
+}
+
 // toJson is the underlying implementation of ToJson and ToPrettyJson.
 func toJson(v interface{}, escape bool, indent string) []byte {
-	var (
-		buf = &bytes.Buffer{}
-		enc = json.NewEncoder(buf)
-	)
+	b, err := JsonEncodeOptions{EscapeHTML: escape, Indent: indent}.Marshal(v)
+	if err != nil {
+		handleJsonError(v, err)
+		return nil
+	}
+	return b
+}
 
-	enc.SetEscapeHTML(escape)
-	enc.SetIndent("", indent)
+// handleJsonError calls JsonErrorHandler if it's not nil.
+func handleJsonError(v interface{}, err error) {
+	if JsonErrorHandler != nil {
+		JsonErrorHandler(v, err)
+	}
+}
 
-	if err := enc.Encode(v); err != nil {
-		return nil
+// JsonEncodeOptions specifies options of JSON encoding. The zero value
+// produces the same output as ToJson function.
+type JsonEncodeOptions struct {
+	// Indent specifies the indentation of each level. If it's empty,
+	// the output is compact.
+	Indent string
+
+	// Prefix specifies the prefix of each line except for the first one,
+	// which is the same as the prefix argument of json.MarshalIndent.
+	Prefix string
+
+	// EscapeHTML specifies whether special characters (&, <, and >) in
+	// quoted strings are escaped.
+	EscapeHTML bool
+
+	// SortKeys specifies whether all object keys are sorted. Keys of maps
+	// are always sorted by encoding/json package; if it's true, fields of
+	// structs are also sorted instead of following the declaration order.
+	SortKeys bool
+
+	// TrailingNewline specifies whether a newline character is appended
+	// to the output.
+	TrailingNewline bool
+}
+
+// Marshal returns the JSON encoding of v according to the options.
+func (o JsonEncodeOptions) Marshal(v interface{}) ([]byte, error) {
+	e, err := encodeJson(v, o)
+	if err != nil {
+		return nil, err
+	}
+	defer jsonEncoderPool.Put(e)
+	return append([]byte(nil), e.buf.Bytes()...), nil
+}
+
+// Encode writes the JSON encoding of v to w according to the options. The
+// JSON encoding is built by a pooled encoder at first, so nothing will be
+// written to w if v can't be encoded.
+func (o JsonEncodeOptions) Encode(w io.Writer, v interface{}) error {
+	e, err := encodeJson(v, o)
+	if err != nil {
+		return err
 	}
+	defer jsonEncoderPool.Put(e)
 
-	b := buf.Bytes()
-	if last := len(b) - 1; len(b) > 0 && b[last] == '\n' {
+	_, err = w.Write(e.buf.Bytes())
+	return err
+}
+
+// encodeJson encodes v according to the options by an encoder fetched from
+// jsonEncoderPool. If it succeeds, the JSON encoding is in the buffer of the
+// returned encoder, the caller should put the encoder back after using it.
+func encodeJson(v interface{}, o JsonEncodeOptions) (*jsonEncoder, error) {
+	if o.SortKeys {
+		sorted, err := sortJsonKeys(v)
+		if err != nil {
+			return nil, err
+		}
+		v = sorted
+	}
+
+	e := jsonEncoderPool.Get()
+	e.enc.SetEscapeHTML(o.EscapeHTML)
+	e.enc.SetIndent(o.Prefix, o.Indent)
+
+	if err := e.enc.Encode(v); err != nil {
+		jsonEncoderPool.Put(e)
+		return nil, err
+	}
+
+	if last := e.buf.Len() - 1; !o.TrailingNewline && last >= 0 && e.buf.Bytes()[last] == '\n' {
 		// json.Encoder.Encode will add a newline character at the
 		// end, so we need to remove it make this function consistent
 		// with json.Marshal.
-		return b[:last]
+		e.buf.Truncate(last)
 	}
-	return b
+	return e, nil
+}
+
+// sortJsonKeys converts v into a generic value which consists of maps, slices
+// and basic types, so all object keys will be sorted when it's encoded.
+func sortJsonKeys(v interface{}) (interface{}, error) {
+	e, err := encodeJson(v, JsonEncodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer jsonEncoderPool.Put(e)
+
+	var x interface{}
+	dec := json.NewDecoder(e.buf)
+	dec.UseNumber() // Keep the original number formatting.
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// ToCanonicalJson returns the canonical JSON encoding of v defined by RFC 8785
+// (JSON Canonicalization Scheme), which is suitable for signing and hashing.
+// Object keys are sorted, insignificant whitespace is removed, and numbers
+// and strings are serialized in the normalized form.
+func ToCanonicalJson(v interface{}) ([]byte, error) {
+	data, err := MarshalJson(v)
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalizeJson(data)
+}
+
+// CanonicalizeJson converts the JSON encoding data into the canonical form
+// defined by RFC 8785. The data must contain exactly one JSON value.
+func CanonicalizeJson(data []byte) ([]byte, error) {
+	var x interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("json: invalid trailing data")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeCanonicalJson(buf, x); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonicalJson writes the canonical JSON encoding of a generic value
+// decoded by json.Decoder (with UseNumber option) to the buffer.
+func writeCanonicalJson(buf *bytes.Buffer, x interface{}) error {
+	switch v := x.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return fmt.Errorf("json: invalid number %s: %w", v, err)
+		}
+		s, err := formatCanonicalNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJson(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// Keys are sorted by their UTF-16 code units.
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonicalJson(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("json: unsupported type %T", x)
+	}
+	return nil
+}
+
+// writeCanonicalString writes the canonical form of a JSON string, only
+// quotation marks, backslashes and control characters are escaped.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatCanonicalNumber formats a number in the same way as the Number.prototype.toString
+// method of ECMAScript, which is required by RFC 8785.
+func formatCanonicalNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("json: unsupported number %v", f)
+	}
+
+	if f == 0 {
+		return "0", nil // Includes negative zero.
+	}
+
+	// The shortest representation which can be round-tripped, like "-1.2345e+21".
+	var (
+		s    = strconv.FormatFloat(f, 'e', -1, 64)
+		sign string
+	)
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+
+	i := strings.IndexByte(s, 'e')
+	exp, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		digits = strings.Replace(s[:i], ".", "", 1)
+		k      = len(digits)
+		n      = exp + 1 // The position of the decimal point.
+	)
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+
+	mantissa := digits[:1]
+	if k > 1 {
+		mantissa += "." + digits[1:]
+	}
+
+	if exp >= 0 {
+		return sign + mantissa + "e+" + strconv.Itoa(exp), nil
+	}
+	return sign + mantissa + "e" + strconv.Itoa(exp), nil
+}
+
+// lessUTF16 reports whether a is less than b when they're compared by UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// JsonDecodeErrorCode is the code of errors returned by FromJson and
+// FromJsonReader functions, which is the same as the parse error code
+// of JSON-RPC 2.0.
+const JsonDecodeErrorCode = -32700
+
+// JsonDecodeOptions specifies options of FromJson and FromJsonReader functions.
+type JsonDecodeOptions struct {
+	// DisallowUnknownFields causes an error when the destination is a struct
+	// and the input contains object keys which don't match any field.
+	DisallowUnknownFields bool
+
+	// UseNumber causes numbers to be decoded into an interface{} as a
+	// json.Number instead of as a float64.
+	UseNumber bool
+
+	// MaxSize specifies the maximum size (in bytes) of the input. If it's
+	// not positive, there is no limit.
+	MaxSize int64
+
+	// DisallowTrailingData causes an error when there is non-whitespace
+	// data after the first JSON value.
+	DisallowTrailingData bool
+}
+
+// JsonDecodeError describes a failure of decoding JSON.
+type JsonDecodeError struct {
+	error // The underlying raw error.
+
+	// Offset represents the input byte offset at which the error occurs.
+	Offset int64
+
+	// Field represents the full path of the field related to the error,
+	// it might be empty.
+	Field string
+}
+
+// Error returns the message of the underlying error with the offset and the field.
+func (e *JsonDecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s (offset %d, field %s)", e.error, e.Offset, e.Field)
+	}
+	return fmt.Sprintf("%s (offset %d)", e.error, e.Offset)
+}
+
+// Unwrap returns the underlying raw error.
+func (e *JsonDecodeError) Unwrap() error {
+	return e.error
+}
+
+// FromJson parses the JSON encoding data and stores the result in the value
+// pointed to by v. The optional argument specifies decode options. If any
+// error occurs, the underlying type of the returned error is *util.Error,
+// the code of which is JsonDecodeErrorCode and which wraps *JsonDecodeError.
+func FromJson(data []byte, v interface{}, opts ...JsonDecodeOptions) error {
+	var opt JsonDecodeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	if opt.MaxSize > 0 && int64(len(data)) > opt.MaxSize {
+		return WrapError(JsonDecodeErrorCode, &JsonDecodeError{error: &ReadLimitError{opt.MaxSize}, Offset: opt.MaxSize})
+	}
+	return fromJson(bytes.NewReader(data), v, opt)
+}
+
+// FromJsonReader is the same as FromJson function except for the JSON encoding
+// data is read from r. Only the first JSON value will be decoded, but r is read
+// in chunks, so data after the value might have been consumed from r when this
+// function returns. Use json.Decoder directly to decode a stream of values.
+func FromJsonReader(r io.Reader, v interface{}, opts ...JsonDecodeOptions) error {
+	var opt JsonDecodeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return fromJson(r, v, opt)
+}
+
+// fromJson is the underlying implementation of FromJson and FromJsonReader.
+func fromJson(r io.Reader, v interface{}, opt JsonDecodeOptions) error {
+	var lr *io.LimitedReader
+	if opt.MaxSize > 0 {
+		// Read one more byte to detect whether the input exceeds the limit.
+		lr = &io.LimitedReader{R: r, N: opt.MaxSize + 1}
+		r = lr
+	}
+
+	dec := json.NewDecoder(r)
+	if opt.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if opt.UseNumber {
+		dec.UseNumber()
+	}
+
+	err := dec.Decode(v)
+	if err == nil && opt.DisallowTrailingData {
+		if _, terr := dec.Token(); terr != io.EOF {
+			err = errors.New("json: invalid trailing data")
+		}
+	}
+
+	if lr != nil && lr.N <= 0 {
+		// The input has exceeded the limit, but the result is only caused by
+		// the truncation when the decoder has reached the limit. Trailing data
+		// beyond the limit can't be checked either.
+		offset := dec.InputOffset()
+		if err != nil {
+			offset = newJsonDecodeError(err, dec).Offset
+		}
+
+		if offset > opt.MaxSize || errors.Is(err, io.ErrUnexpectedEOF) || (err == nil && opt.DisallowTrailingData) {
+			err = &ReadLimitError{opt.MaxSize}
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+	return WrapError(JsonDecodeErrorCode, newJsonDecodeError(err, dec))
+}
+
+// newJsonDecodeError extracts the offset and the field from the error.
+func newJsonDecodeError(err error, dec *json.Decoder) *JsonDecodeError {
+	e := &JsonDecodeError{error: err, Offset: dec.InputOffset()}
+
+	var (
+		se *json.SyntaxError
+		te *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &se):
+		e.Offset = se.Offset
+	case errors.As(err, &te):
+		e.Offset, e.Field = te.Offset, te.Field
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json doesn't export the type of this error.
+		e.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+	}
+	return e
 }
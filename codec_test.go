@@ -3,14 +3,17 @@
 // Author: blinklv <blinklv@icloud.com>
 // Create Time: 2020-05-08
 // Maintainer: blinklv <blinklv@icloud.com>
-// Last Change: 2020-05-08
+// Last Change: 2026-10-19
 
 package util
 
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -59,3 +62,357 @@ func TestToPrettyJson(t *testing.T) {
 	json.Indent(out, ToJson(o), "", "\t")
 	assert.Equal(t, out.String(), string(ToPrettyJson(o)))
 }
+
+func TestAppendJson(t *testing.T) {
+	for i, v := range []interface{}{
+		nil,
+		-123,
+		"<foo>hello</foo>",
+		map[string]interface{}{"url": "https://www.bar.com/foo/path?a=b&c=1&hello=200"},
+	} {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert.Equal(t, "prefix:"+string(ToJson(v)), string(AppendJson([]byte("prefix:"), v)))
+
+			w := &bytes.Buffer{}
+			assert.NoError(t, ToJsonWriter(w, v))
+			assert.Equal(t, string(ToJson(v)), w.String())
+		})
+	}
+
+	// Invalid values.
+	assert.Equal(t, "prefix:", string(AppendJson([]byte("prefix:"), make(chan int))))
+	w := &bytes.Buffer{}
+	assert.Error(t, ToJsonWriter(w, make(chan int)))
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestMarshalJson(t *testing.T) {
+	o := map[string]interface{}{
+		"hello": "<foo>&</foo>",
+		"world": []int{1, 2, 3},
+	}
+
+	b, err := MarshalJson(o)
+	assert.NoError(t, err)
+	assert.Equal(t, string(ToJson(o)), string(b))
+
+	b, err = MarshalPrettyJson(o)
+	assert.NoError(t, err)
+	assert.Equal(t, string(ToPrettyJson(o)), string(b))
+
+	for _, v := range []interface{}{
+		make(chan int),
+		math.NaN(),
+		map[string]interface{}{"f": func() {}},
+	} {
+		b, err = MarshalJson(v)
+		assert.Error(t, err)
+		assert.Nil(t, b)
+
+		b, err = MarshalPrettyJson(v)
+		assert.Error(t, err)
+		assert.Nil(t, b)
+	}
+}
+
+func TestJsonErrorHandler(t *testing.T) {
+	var errs []error
+	JsonErrorHandler = func(v interface{}, err error) {
+		errs = append(errs, err)
+	}
+	defer func() { JsonErrorHandler = nil }()
+
+	assert.Nil(t, ToJson(make(chan int)))
+	assert.Nil(t, ToPrettyJson(math.Inf(1)))
+	assert.Equal(t, "", string(AppendJson(nil, make(chan int))))
+	assert.Equal(t, "1", string(ToJson(1)))
+	assert.Equal(t, 3, len(errs))
+}
+
+func TestFromJson(t *testing.T) {
+	type inner struct {
+		Age int `json:"age"`
+	}
+	type person struct {
+		Name  string `json:"name"`
+		Inner inner  `json:"inner"`
+	}
+
+	// 1. Check normal cases.
+	var p person
+	assert.NoError(t, FromJson([]byte(`{"name":"Andy","inner":{"age":12},"extra":1}`), &p))
+	assert.Equal(t, person{"Andy", inner{12}}, p)
+
+	var x interface{}
+	assert.NoError(t, FromJson([]byte(`{"n":12345678901234567890}`), &x, JsonDecodeOptions{UseNumber: true}))
+	assert.Equal(t, json.Number("12345678901234567890"), x.(map[string]interface{})["n"])
+
+	assert.NoError(t, FromJson([]byte(`{"name":"Gina"}  `), &p, JsonDecodeOptions{DisallowTrailingData: true, MaxSize: 18}))
+
+	// 2. Check errors.
+	for _, cs := range []struct {
+		Data    string            `json:"data"`
+		Options JsonDecodeOptions `json:"options"`
+		Offset  int64             `json:"offset"`
+		Field   string            `json:"field"`
+	}{
+		{`{"name":}`, JsonDecodeOptions{}, 9, ""},
+		{`{"name":"Andy","inner":{"age":"12"}}`, JsonDecodeOptions{}, 34, "inner.age"},
+		{`{"name":"Andy","extra":1}`, JsonDecodeOptions{DisallowUnknownFields: true}, 25, "extra"},
+		{`{"name":"Andy"} {}`, JsonDecodeOptions{DisallowTrailingData: true}, 17, ""},
+		{`{"name":"Andy"}`, JsonDecodeOptions{MaxSize: 10}, 10, ""},
+		{``, JsonDecodeOptions{}, 0, ""},
+	} {
+		t.Run(encodeCase(cs), func(t *testing.T) {
+			err := FromJson([]byte(cs.Data), &p, cs.Options)
+			t.Logf("%s", err)
+
+			var ue *Error
+			assert.True(t, errors.As(err, &ue))
+			assert.Equal(t, JsonDecodeErrorCode, ue.Code)
+
+			var de *JsonDecodeError
+			assert.True(t, errors.As(err, &de))
+			assert.Equal(t, cs.Offset, de.Offset)
+			assert.Equal(t, cs.Field, de.Field)
+		})
+	}
+}
+
+func TestFromJsonReader(t *testing.T) {
+	var (
+		r = strings.NewReader(`{"a":1} {"a":2}`)
+		v map[string]int
+	)
+
+	assert.NoError(t, FromJsonReader(r, &v))
+	assert.Equal(t, 1, v["a"])
+
+	// The input exceeds the limit.
+	err := FromJsonReader(strings.NewReader(`{"a":"`+strings.Repeat("x", 100)+`"}`), &v, JsonDecodeOptions{MaxSize: 50})
+	var le *ReadLimitError
+	assert.True(t, errors.As(err, &le))
+	assert.Equal(t, int64(50), le.Limit)
+
+	// A syntax error before the limit isn't reported as exceeding the limit.
+	err = FromJsonReader(strings.NewReader(`{"a":x`+strings.Repeat(" ", 100)+`}`), &v, JsonDecodeOptions{MaxSize: 50})
+	assert.False(t, errors.As(err, &le))
+	var de *JsonDecodeError
+	assert.True(t, errors.As(err, &de))
+	assert.Equal(t, int64(6), de.Offset)
+
+	// A value within the limit is decoded even if the input is longer.
+	assert.NoError(t, FromJsonReader(strings.NewReader(`{"a":3}`+strings.Repeat(" ", 100)), &v, JsonDecodeOptions{MaxSize: 50}))
+	assert.Equal(t, 3, v["a"])
+
+	// A truncated value which is still valid.
+	var n int
+	err = FromJsonReader(strings.NewReader(`12345`), &n, JsonDecodeOptions{MaxSize: 3})
+	assert.True(t, errors.As(err, &le))
+
+	// Trailing data beyond the limit can't be checked.
+	err = FromJsonReader(strings.NewReader(`{"a":1}`+strings.Repeat(" ", 100)+`x`), &v, JsonDecodeOptions{MaxSize: 50, DisallowTrailingData: true})
+	assert.True(t, errors.As(err, &le))
+
+	// Trailing data.
+	err = FromJsonReader(strings.NewReader(`{"a":1} x`), &v, JsonDecodeOptions{DisallowTrailingData: true})
+	assert.Error(t, err)
+}
+
+func TestJsonEncodeOptions(t *testing.T) {
+	type item struct {
+		Zoo   string      `json:"zoo"`
+		Alpha int         `json:"alpha"`
+		Extra interface{} `json:"extra"`
+	}
+	v := item{"<a&b>", 1, map[string]interface{}{"y": 1.50, "x": []int{1, 2}}}
+
+	for _, cs := range []struct {
+		Options JsonEncodeOptions `json:"options"`
+		Output  string            `json:"output"`
+	}{
+		{JsonEncodeOptions{}, `{"zoo":"<a&b>","alpha":1,"extra":{"x":[1,2],"y":1.5}}`},
+		{JsonEncodeOptions{EscapeHTML: true}, `{"zoo":"\u003ca\u0026b\u003e","alpha":1,"extra":{"x":[1,2],"y":1.5}}`},
+		{JsonEncodeOptions{SortKeys: true}, `{"alpha":1,"extra":{"x":[1,2],"y":1.5},"zoo":"<a&b>"}`},
+		{JsonEncodeOptions{SortKeys: true, EscapeHTML: true}, `{"alpha":1,"extra":{"x":[1,2],"y":1.5},"zoo":"\u003ca\u0026b\u003e"}`},
+		{JsonEncodeOptions{TrailingNewline: true}, `{"zoo":"<a&b>","alpha":1,"extra":{"x":[1,2],"y":1.5}}` + "\n"},
+		{JsonEncodeOptions{Indent: "  ", Prefix: "//", SortKeys: true}, `{
+//  "alpha": 1,
+//  "extra": {
+//    "x": [
+//      1,
+//      2
+//    ],
+//    "y": 1.5
+//  },
+//  "zoo": "<a&b>"
+//}`},
+	} {
+		t.Run(encodeCase(cs), func(t *testing.T) {
+			b, err := cs.Options.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, cs.Output, string(b))
+
+			w := &bytes.Buffer{}
+			assert.NoError(t, cs.Options.Encode(w, v))
+			assert.Equal(t, cs.Output, w.String())
+		})
+	}
+
+	// The zero value is consistent with ToJson and ToPrettyJson.
+	b, _ := JsonEncodeOptions{}.Marshal(v)
+	assert.Equal(t, string(ToJson(v)), string(b))
+	b, _ = JsonEncodeOptions{Indent: "\t"}.Marshal(v)
+	assert.Equal(t, string(ToPrettyJson(v)), string(b))
+
+	_, err := JsonEncodeOptions{SortKeys: true}.Marshal(make(chan int))
+	assert.Error(t, err)
+	assert.Error(t, JsonEncodeOptions{}.Encode(&bytes.Buffer{}, make(chan int)))
+}
+
+func TestToCanonicalJson(t *testing.T) {
+	// The example of RFC 8785 section 3.2.2.
+	data := []byte(`{
+		"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+		"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+		"literals": [null, true, false]
+	}`)
+	b, err := CanonicalizeJson(data)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`, string(b))
+
+	// The example of RFC 8785 section 3.2.3, keys are sorted by UTF-16 code units.
+	data = []byte(`{
+		"\u20ac": "Euro Sign",
+		"\r": "Carriage Return",
+		"\ufb33": "Hebrew Letter Dalet With Dagesh",
+		"1": "One",
+		"\ud83d\ude00": "Emoji: Grinning Face",
+		"\u0080": "Control",
+		"\u00f6": "Latin Small Letter O With Diaeresis"
+	}`)
+	var x map[string]string
+	assert.NoError(t, json.Unmarshal(data, &x))
+	b, err = ToCanonicalJson(x)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\","+
+		"\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\","+
+		"\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}", string(b))
+
+	// HTML characters are not escaped.
+	b, err = ToCanonicalJson(struct {
+		B string `json:"b"`
+		A []int  `json:"a"`
+	}{"<a&b>", []int{}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":[],"b":"<a&b>"}`, string(b))
+
+	for _, data := range []string{``, `{"a":1`, `1 2`, `1e400`} {
+		_, err = CanonicalizeJson([]byte(data))
+		assert.Error(t, err, data)
+	}
+	_, err = ToCanonicalJson(math.NaN())
+	assert.Error(t, err)
+}
+
+func TestFormatCanonicalNumber(t *testing.T) {
+	// The test vectors of RFC 8785 appendix B.
+	for _, cs := range []struct {
+		Bits   uint64 `json:"bits"`
+		Output string `json:"output"`
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	} {
+		t.Run(encodeCase(cs), func(t *testing.T) {
+			s, err := formatCanonicalNumber(math.Float64frombits(cs.Bits))
+			assert.NoError(t, err)
+			assert.Equal(t, cs.Output, s)
+		})
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err := formatCanonicalNumber(f)
+		assert.Error(t, err)
+	}
+}
+
+// benchmarkJsonValue is a typical log record.
+var benchmarkJsonValue = map[string]interface{}{
+	"time":    "2020-05-08T12:00:00Z",
+	"level":   "info",
+	"message": "request completed",
+	"url":     "https://www.bar.com/foo/path?a=b&c=1&hello=200",
+	"status":  200,
+	"latency": 0.0123,
+}
+
+// BenchmarkJsonMarshal is the reference of the standard library.
+func BenchmarkJsonMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		json.Marshal(benchmarkJsonValue)
+	}
+}
+
+// BenchmarkToJsonUnpooled is the reference of the original implementation of
+// ToJson, which allocates an encoder and a buffer for each call.
+func BenchmarkToJsonUnpooled(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var (
+			buf = &bytes.Buffer{}
+			enc = json.NewEncoder(buf)
+		)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "")
+		enc.Encode(benchmarkJsonValue)
+		_ = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	}
+}
+
+func BenchmarkToJson(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ToJson(benchmarkJsonValue)
+	}
+}
+
+func BenchmarkAppendJson(b *testing.B) {
+	b.ReportAllocs()
+	dst := make([]byte, 0, 1024)
+	for i := 0; i < b.N; i++ {
+		dst = AppendJson(dst[:0], benchmarkJsonValue)
+	}
+}
+
+func BenchmarkToJsonWriter(b *testing.B) {
+	b.ReportAllocs()
+	w := &bytes.Buffer{}
+	for i := 0; i < b.N; i++ {
+		w.Reset()
+		ToJsonWriter(w, benchmarkJsonValue)
+	}
+}
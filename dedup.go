@@ -0,0 +1,137 @@
+// dedup.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// DedupGroup deduplicates concurrent function calls with the same key, which
+// is similar to golang.org/x/sync/singleflight. Only one function call will
+// be executed for a key at a time, and its result is shared by all callers.
+type DedupGroup struct {
+	locker sync.Mutex
+	calls  map[string]*dedupCall
+
+	// Logger specifies an optional logger for unexpected behaviors, which
+	// lead to panic, from callback functions.
+	Logger *log.Logger
+}
+
+// DedupResult holds the result of a function call of DedupGroup.
+type DedupResult struct {
+	// Val is the first return value of the function call.
+	Val interface{}
+
+	// Err is the second return value of the function call, or the error
+	// converted from the panic.
+	Err error
+
+	// Shared reports whether the result is shared by multiple callers.
+	Shared bool
+}
+
+// dedupCall represents a function call which is in-flight or completed.
+type dedupCall struct {
+	wg    sync.WaitGroup
+	val   interface{}
+	err   error
+	dups  int
+	chans []chan<- DedupResult
+}
+
+// Do executes the function and returns its results, making sure that only
+// one execution is in-flight for the key at a time. If a duplicate comes in,
+// the duplicate caller waits for the original one to complete and receives
+// the same results. The shared return value reports whether the results are
+// shared by multiple callers. If the function panics, the panic will be
+// recovered and converted into an error returned to all callers.
+func (dg *DedupGroup) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	dg.locker.Lock()
+	if dg.calls == nil {
+		dg.calls = make(map[string]*dedupCall)
+	}
+
+	if c, ok := dg.calls[key]; ok {
+		c.dups++
+		dg.locker.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := &dedupCall{}
+	c.wg.Add(1)
+	dg.calls[key] = c
+	dg.locker.Unlock()
+
+	dg.call(c, key, fn)
+	return c.val, c.err, c.dups > 0
+}
+
+// DoChan is like Do method but returns a channel that will receive the
+// result when it's ready. The returned channel will not be closed.
+func (dg *DedupGroup) DoChan(key string, fn func() (interface{}, error)) <-chan DedupResult {
+	ch := make(chan DedupResult, 1)
+
+	dg.locker.Lock()
+	if dg.calls == nil {
+		dg.calls = make(map[string]*dedupCall)
+	}
+
+	if c, ok := dg.calls[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		dg.locker.Unlock()
+		return ch
+	}
+
+	c := &dedupCall{chans: []chan<- DedupResult{ch}}
+	c.wg.Add(1)
+	dg.calls[key] = c
+	dg.locker.Unlock()
+
+	go dg.call(c, key, fn)
+	return ch
+}
+
+// Forget tells the DedupGroup to forget the key. Future calls to Do method
+// for this key will execute the function rather than waiting for an earlier
+// call to complete.
+func (dg *DedupGroup) Forget(key string) {
+	dg.locker.Lock()
+	delete(dg.calls, key)
+	dg.locker.Unlock()
+}
+
+// call executes the function for the key and notifies all waiters.
+func (dg *DedupGroup) call(c *dedupCall, key string, fn func() (interface{}, error)) {
+	defer func() {
+		if x := recover(); x != nil {
+			c.err = fmt.Errorf("%v", x)
+			if dg.Logger != nil {
+				dg.Logger.Printf("panic (%s): %v\n%s", key, x, debug.Stack())
+			}
+		}
+
+		dg.locker.Lock()
+		// The key might have been forgotten and replaced by a new call.
+		if dg.calls[key] == c {
+			delete(dg.calls, key)
+		}
+		c.wg.Done()
+		for _, ch := range c.chans {
+			ch <- DedupResult{c.val, c.err, c.dups > 0}
+		}
+		dg.locker.Unlock()
+	}()
+
+	c.val, c.err = fn()
+}
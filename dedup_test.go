@@ -0,0 +1,134 @@
+// dedup_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupGroup(t *testing.T) {
+	var (
+		dg      = &DedupGroup{}
+		calls   int64
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+
+	// 1. Check concurrent calls share a single execution.
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, shared := dg.Do("foo", func() (interface{}, error) {
+				atomic.AddInt64(&calls, 1)
+				<-release
+				return "bar", nil
+			})
+			assert.Equal(t, "bar", v)
+			assert.NoError(t, err)
+			assert.True(t, shared)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls))
+
+	// 2. Check results are not cached after the call completes.
+	v, err, shared := dg.Do("foo", func() (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	assert.Nil(t, v)
+	assert.EqualError(t, err, "failed")
+	assert.False(t, shared)
+}
+
+func TestDedupGroupDoChan(t *testing.T) {
+	var (
+		dg      = &DedupGroup{}
+		release = make(chan struct{})
+	)
+
+	ch1 := dg.DoChan("foo", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	ch2 := dg.DoChan("foo", func() (interface{}, error) {
+		return 2, nil
+	})
+	close(release)
+
+	for _, ch := range []<-chan DedupResult{ch1, ch2} {
+		res := <-ch
+		assert.Equal(t, 1, res.Val)
+		assert.NoError(t, res.Err)
+		assert.True(t, res.Shared)
+	}
+}
+
+func TestDedupGroupForget(t *testing.T) {
+	var (
+		dg      = &DedupGroup{}
+		release = make(chan struct{})
+	)
+
+	ch := dg.DoChan("foo", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+
+	dg.Forget("foo")
+	v, _, shared := dg.Do("foo", func() (interface{}, error) {
+		return 2, nil
+	})
+	assert.Equal(t, 2, v)
+	assert.False(t, shared)
+
+	close(release)
+	assert.Equal(t, 1, (<-ch).Val)
+}
+
+func TestDedupGroupPanic(t *testing.T) {
+	var (
+		out     = &bytes.Buffer{}
+		dg      = &DedupGroup{Logger: log.New(out, "", 0)}
+		release = make(chan struct{})
+	)
+
+	ch := dg.DoChan("foo", func() (interface{}, error) {
+		<-release
+		panic("oops")
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err, shared := dg.Do("foo", func() (interface{}, error) {
+			return nil, nil
+		})
+		assert.EqualError(t, err, "oops")
+		assert.True(t, shared)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	assert.EqualError(t, (<-ch).Err, "oops")
+	wg.Wait()
+	assert.True(t, strings.HasPrefix(out.String(), "panic (foo): oops\n"))
+}
@@ -3,15 +3,19 @@
 // Author: blinklv <blinklv@icloud.com>
 // Create Time: 2020-06-03
 // Maintainer: blinklv <blinklv@icloud.com>
-// Last Change: 2021-05-17
+// Last Change: 2026-10-19
 
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"runtime/debug"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Group is a collection of goroutines which usually run simultaneously.
@@ -19,10 +23,24 @@ type Group struct {
 	wg     sync.WaitGroup
 	locker sync.Mutex
 	result []interface{}
+	stats  GroupStats
 
 	// Logger specifies an optional logger for unexpected behaviors, which
 	// lead to panic, from callback functions.
 	Logger *log.Logger
+
+	// OnStart specifies an optional hook which is called before a function
+	// call starts. The name parameter is empty for anonymous function calls.
+	OnStart func(name string)
+
+	// OnFinish specifies an optional hook which is called after a function
+	// call has returned (or panicked). The res parameter is the return value
+	// of the function call, or the error converted from the panic.
+	OnFinish func(name string, d time.Duration, res interface{})
+
+	// OnPanic specifies an optional hook which is called when a function
+	// call panics. The x parameter is the value passed to panic.
+	OnPanic func(name string, x interface{})
 }
 
 // Go method is similar to 'go' statement which starts the execution of
@@ -31,30 +49,216 @@ type Group struct {
 // can use the closure feature to inject parameters) and returns a value
 // of any type. If the return value is (no type) nil, it will be ignored.
 func (g *Group) Go(f func() interface{}) {
+	g.run("", f)
+}
+
+// GoNamed method is the same as Go method except for the function call
+// has a name. If the function panics or returns an error, the error will
+// be wrapped into a *TaskError with the name, so you can tell which task
+// produces it from the result of Error method.
+func (g *Group) GoNamed(name string, f func() interface{}) {
+	g.run(name, f)
+}
+
+// run is the underlying implementation of Go and GoNamed methods. An empty
+// name means the function call is anonymous.
+func (g *Group) run(name string, f func() interface{}) {
 	g.wg.Add(1)
+	g.start(name)
+
 	go func() {
+		var (
+			res   interface{}
+			begin = time.Now()
+		)
+
 		defer func() {
-			if x := recover(); x != nil {
-				g.result = append(g.result, fmt.Errorf("%v", x))
+			x := recover()
+			if x != nil {
+				res = wrapTaskError(name, fmt.Errorf("%v", x))
+				g.add(res)
 				if g.Logger != nil {
-					g.Logger.Printf("panic: %v\n%s", x, debug.Stack())
+					if name != "" {
+						g.Logger.Printf("panic (%s): %v\n%s", name, x, debug.Stack())
+					} else {
+						g.Logger.Printf("panic: %v\n%s", x, debug.Stack())
+					}
+				}
+				if g.OnPanic != nil {
+					g.OnPanic(name, x)
 				}
 			}
 
+			g.finish(name, time.Since(begin), res, x != nil)
+
 			// We need to place Done operation at here instead of the end
 			// of this anonymous function, cause the custom function 'f'
 			// might be panic.
 			g.wg.Done()
 		}()
 
-		if res := f(); res != nil {
+		if res = f(); res != nil {
 			// Only when the return value of the function is not nil, the
 			// value will be added to the collection of results.
+			if e, ok := res.(error); ok {
+				res = wrapTaskError(name, e)
+			}
+			g.add(res)
+		}
+	}()
+}
+
+// RestartPolicy specifies how GoSupervised method restarts a function call.
+type RestartPolicy struct {
+	// Backoff specifies the delay before each restart. The n-th consecutive
+	// failure uses the n-th backoff duration. A function call which has run
+	// for at least Period (or one minute if Period isn't positive) before it
+	// fails is considered healthy, so the backoff starts over.
+	Backoff
+
+	// MaxRestarts specifies the maximum number of restarts in Period. When
+	// the limit is exceeded, the function call won't be restarted anymore.
+	// If it's not positive, there is no limit.
+	MaxRestarts int
+
+	// Period specifies the time window of MaxRestarts. If it's not positive,
+	// all restarts since the first call are counted.
+	Period time.Duration
+}
+
+// defaultRestartResetAfter is the running duration after which the backoff of
+// GoSupervised starts over if the Period of RestartPolicy isn't positive.
+const defaultRestartResetAfter = time.Minute
+
+// GoSupervised method is similar to GoNamed method except for the function
+// call will be restarted after it panics or returns an error, like Erlang
+// supervisors. The function call stops when it returns nil, or the context
+// is done, or the restart intensity specified by the policy is exceeded. In
+// the last case, the last error will be added to results. Panics recovered
+// from the function call and restarts are counted in the RecoveredPanics and
+// the Restarts fields of GroupStats respectively.
+func (g *Group) GoSupervised(ctx context.Context, name string, policy RestartPolicy, f func(ctx context.Context) error) {
+	resetAfter := policy.Period
+	if resetAfter <= 0 {
+		resetAfter = defaultRestartResetAfter
+	}
+
+	g.run(name, func() interface{} {
+		var (
+			restarts []time.Time // Only used when MaxRestarts is positive.
+			failures int         // The number of consecutive failures.
+		)
+
+		for {
+			begin := time.Now()
+			err := g.supervise(ctx, name, f)
+			if err == nil || ctx.Err() != nil {
+				return nil
+			}
+
+			now := time.Now()
+			if now.Sub(begin) >= resetAfter {
+				failures = 0
+			}
+			failures++
+
+			if policy.MaxRestarts > 0 {
+				if policy.Period > 0 {
+					// Drop restarts which are out of the time window.
+					i := 0
+					for i < len(restarts) && now.Sub(restarts[i]) > policy.Period {
+						i++
+					}
+					restarts = restarts[i:]
+				}
+				restarts = append(restarts, now)
+
+				// Returning here also bounds len(restarts) by MaxRestarts+1.
+				if len(restarts) > policy.MaxRestarts {
+					return fmt.Errorf("restart intensity exceeded (%d restarts): %w", policy.MaxRestarts, err)
+				}
+			}
+
 			g.locker.Lock()
-			g.result = append(g.result, res)
+			g.stats.Restarts++
 			g.locker.Unlock()
+
+			d := policy.Duration(failures)
+			if g.Logger != nil {
+				g.Logger.Printf("restart (%s) after %s: %v", name, d, err)
+			}
+
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			}
+		}
+	})
+}
+
+// supervise calls the supervised function and converts the panic caused by
+// it into an error.
+func (g *Group) supervise(ctx context.Context, name string, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("%v", x)
+
+			g.locker.Lock()
+			g.stats.RecoveredPanics++
+			g.locker.Unlock()
+
+			if g.Logger != nil {
+				g.Logger.Printf("panic (%s): %v\n%s", name, x, debug.Stack())
+			}
+			if g.OnPanic != nil {
+				g.OnPanic(name, x)
+			}
 		}
 	}()
+	return f(ctx)
+}
+
+// start updates statistics and calls OnStart hook before a function call starts.
+func (g *Group) start(name string) {
+	g.locker.Lock()
+	g.stats.Started++
+	g.stats.InFlight++
+	if g.stats.InFlight > g.stats.MaxInFlight {
+		g.stats.MaxInFlight = g.stats.InFlight
+	}
+	g.locker.Unlock()
+
+	if g.OnStart != nil {
+		g.OnStart(name)
+	}
+}
+
+// finish updates statistics and calls OnFinish hook after a function call has returned.
+func (g *Group) finish(name string, d time.Duration, res interface{}, panicked bool) {
+	g.locker.Lock()
+	g.stats.Finished++
+	g.stats.InFlight--
+	if panicked {
+		g.stats.Panicked++
+	} else if _, ok := res.(error); ok {
+		g.stats.Errored++
+	}
+	g.stats.Durations.observe(d)
+	g.locker.Unlock()
+
+	if g.OnFinish != nil {
+		g.OnFinish(name, d, res)
+	}
+}
+
+// add appends a value to the collection of results.
+func (g *Group) add(res interface{}) {
+	g.locker.Lock()
+	g.result = append(g.result, res)
+	g.locker.Unlock()
 }
 
 // Result method blocks until all function calls from the Go method have
@@ -107,3 +311,126 @@ func (g *Group) Error(args ...interface{}) error {
 
 	return ef(es)
 }
+
+// Stats returns a snapshot of the execution statistics of all function calls
+// since the Group was created. Unlike results, statistics won't be cleared
+// by Result method.
+func (g *Group) Stats() GroupStats {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+	return g.stats.clone()
+}
+
+// GroupStats represents the execution statistics of a Group.
+type GroupStats struct {
+	// Started is the number of function calls which have started.
+	Started int64
+
+	// Finished is the number of function calls which have returned,
+	// including panicked ones.
+	Finished int64
+
+	// Panicked is the number of function calls which have panicked.
+	Panicked int64
+
+	// RecoveredPanics is the number of panics which have been recovered by
+	// GoSupervised method, they're not counted in Panicked.
+	RecoveredPanics int64
+
+	// Restarts is the number of restarts performed by GoSupervised method.
+	Restarts int64
+
+	// Errored is the number of function calls which have returned an error.
+	Errored int64
+
+	// InFlight is the number of function calls which are running now.
+	InFlight int64
+
+	// MaxInFlight is the maximum number of function calls which have run
+	// simultaneously.
+	MaxInFlight int64
+
+	// Durations is the histogram of the execution time of function calls.
+	Durations DurationHistogram
+}
+
+// clone returns a deep copy of the statistics.
+func (gs GroupStats) clone() GroupStats {
+	gs.Durations.Bounds = append([]time.Duration(nil), gs.Durations.Bounds...)
+	gs.Durations.Counts = append([]int64(nil), gs.Durations.Counts...)
+	return gs
+}
+
+// DefaultDurationBounds is the upper bounds of DurationHistogram buckets. It's
+// copied into each histogram on the first observation, so changing it later
+// only affects groups which haven't run any function call.
+var DefaultDurationBounds = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// DurationHistogram is a histogram of durations. Counts[i] is the number of
+// durations which are less than or equal to Bounds[i] (and greater than the
+// previous bound), and the last element of Counts is the number of durations
+// which are greater than all bounds.
+type DurationHistogram struct {
+	Bounds []time.Duration
+	Counts []int64
+}
+
+// observe adds a duration to the histogram.
+func (dh *DurationHistogram) observe(d time.Duration) {
+	if dh.Counts == nil {
+		dh.Bounds = append([]time.Duration(nil), DefaultDurationBounds...)
+		dh.Counts = make([]int64, len(dh.Bounds)+1)
+	}
+
+	i := sort.Search(len(dh.Bounds), func(i int) bool { return d <= dh.Bounds[i] })
+	dh.Counts[i]++
+}
+
+// TaskError is the error produced by a named function call of a Group. It
+// records the name of the function call in addition to the raw error.
+type TaskError struct {
+	error // The underlying raw error.
+
+	// Name represents the name of the function call.
+	Name string
+
+	// Code represents the error code of the underlying error if its type
+	// is *util.Error, otherwise it's zero.
+	Code int
+}
+
+// Error returns the message of the underlying error prefixed by the name
+// (and the error code if it's not zero).
+func (e *TaskError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s (%d): %s", e.Name, e.Code, e.error)
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.error)
+}
+
+// Unwrap returns the underlying raw error.
+func (e *TaskError) Unwrap() error {
+	return e.error
+}
+
+// wrapTaskError wraps the raw error into a *TaskError. If the name is empty,
+// the raw error will be returned directly.
+func wrapTaskError(name string, err error) error {
+	if name == "" {
+		return err
+	}
+
+	te := &TaskError{error: err, Name: name}
+	var ue *Error
+	if errors.As(err, &ue) {
+		te.Code = ue.Code
+	}
+	return te
+}
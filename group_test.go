@@ -3,15 +3,19 @@
 // Author: blinklv <blinklv@icloud.com>
 // Create Time: 2020-06-04
 // Maintainer: blinklv <blinklv@icloud.com>
-// Last Change: 2021-05-17
+// Last Change: 2026-10-19
 
 package util
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -69,7 +73,6 @@ func TestGroup(t *testing.T) {
 		}()
 
 		panic("bar")
-		return "foo"
 	})
 
 	assert.True(t, g.Result() == nil)
@@ -78,7 +81,6 @@ func TestGroup(t *testing.T) {
 	// 5. Check panic case 2.
 	g.Go(func() interface{} {
 		panic(errors.New("Hello, Boy!"))
-		return "bar"
 	})
 
 	res := g.Result()
@@ -90,7 +92,6 @@ func TestGroup(t *testing.T) {
 	g = &Group{Logger: log.New(os.Stderr, "", log.LstdFlags)}
 	g.Go(func() interface{} {
 		panic("Hi!")
-		return nil
 	})
 	res = g.Result()
 	e, ok = res[0].(error)
@@ -100,7 +101,6 @@ func TestGroup(t *testing.T) {
 	// 7. Check Error method case 1.
 	g.Go(func() interface{} {
 		panic("error A")
-		return nil
 	})
 	g.Go(func() interface{} {
 		return errors.New("error B")
@@ -135,3 +135,228 @@ func TestGroup(t *testing.T) {
 	assert.NoError(t, e)
 	assert.Nil(t, g.Result())
 }
+
+func TestGroupNamed(t *testing.T) {
+	var (
+		out = &bytes.Buffer{}
+		g   = &Group{Logger: log.New(out, "", 0)}
+	)
+
+	g.GoNamed("foo", func() interface{} {
+		return errors.New("failed")
+	})
+	g.GoNamed("bar", func() interface{} {
+		return Errorf(404, "not found")
+	})
+	g.GoNamed("baz", func() interface{} {
+		panic("oops")
+	})
+	g.GoNamed("qux", func() interface{} {
+		return "not an error"
+	})
+	g.Go(func() interface{} {
+		return errors.New("anonymous")
+	})
+
+	res := g.Result()
+	assert.Equal(t, 5, len(res))
+
+	var msgs []string
+	for _, x := range res {
+		switch v := x.(type) {
+		case *TaskError:
+			msgs = append(msgs, v.Error())
+			if v.Name == "bar" {
+				assert.Equal(t, 404, v.Code)
+				var ue *Error
+				assert.True(t, errors.As(v, &ue))
+			}
+		case error:
+			assert.EqualError(t, v, "anonymous")
+		default:
+			assert.Equal(t, "not an error", v)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{
+		"foo: failed",
+		"bar (404): not found",
+		"baz: oops",
+	}, msgs)
+	assert.True(t, strings.HasPrefix(out.String(), "panic (baz): oops\n"))
+}
+
+func TestGroupStats(t *testing.T) {
+	var (
+		locker   sync.Mutex
+		started  []string
+		finished []string
+		panicked []string
+		g        = &Group{}
+	)
+
+	g.OnStart = func(name string) {
+		locker.Lock()
+		started = append(started, name)
+		locker.Unlock()
+	}
+	g.OnFinish = func(name string, d time.Duration, res interface{}) {
+		locker.Lock()
+		finished = append(finished, name)
+		locker.Unlock()
+	}
+	g.OnPanic = func(name string, x interface{}) {
+		locker.Lock()
+		panicked = append(panicked, fmt.Sprintf("%s:%v", name, x))
+		locker.Unlock()
+	}
+
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		g.GoNamed(fmt.Sprintf("wait-%d", i), func() interface{} {
+			<-release
+			return nil
+		})
+	}
+
+	stats := g.Stats()
+	assert.Equal(t, int64(4), stats.Started)
+	assert.Equal(t, int64(4), stats.InFlight)
+	assert.Equal(t, int64(0), stats.Finished)
+	close(release)
+
+	g.GoNamed("error", func() interface{} {
+		return errors.New("failed")
+	})
+	g.GoNamed("panic", func() interface{} {
+		panic("oops")
+	})
+	g.Go(func() interface{} {
+		time.Sleep(20 * time.Millisecond)
+		return 1
+	})
+	g.Result()
+
+	stats = g.Stats()
+	assert.Equal(t, int64(7), stats.Started)
+	assert.Equal(t, int64(7), stats.Finished)
+	assert.Equal(t, int64(1), stats.Panicked)
+	assert.Equal(t, int64(1), stats.Errored)
+	assert.Equal(t, int64(0), stats.InFlight)
+	assert.True(t, stats.MaxInFlight >= 4)
+	assert.Equal(t, len(DefaultDurationBounds)+1, len(stats.Durations.Counts))
+
+	var total int64
+	for _, n := range stats.Durations.Counts {
+		total += n
+	}
+	assert.Equal(t, int64(7), total)
+
+	assert.Equal(t, 7, len(started))
+	assert.ElementsMatch(t, started, finished)
+	assert.Equal(t, []string{"panic:oops"}, panicked)
+
+	// Snapshots and histograms don't alias the default bounds.
+	stats.Durations.Bounds[0] = time.Hour
+	assert.Equal(t, time.Millisecond, g.Stats().Durations.Bounds[0])
+	assert.Equal(t, time.Millisecond, DefaultDurationBounds[0])
+
+	bounds := DefaultDurationBounds
+	DefaultDurationBounds = []time.Duration{time.Second}
+	g.Go(func() interface{} { return nil })
+	g.Result()
+	DefaultDurationBounds = bounds
+	assert.Equal(t, len(bounds)+1, len(g.Stats().Durations.Counts))
+}
+
+func TestGroupSupervised(t *testing.T) {
+	var (
+		out    = &bytes.Buffer{}
+		g      = &Group{Logger: log.New(out, "", 0)}
+		policy = RestartPolicy{Backoff: Backoff{Initial: time.Millisecond}, MaxRestarts: 3, Period: time.Minute}
+		calls  int
+	)
+
+	// 1. Check the function call is restarted until it succeeds.
+	g.GoSupervised(context.Background(), "flaky", policy, func(ctx context.Context) error {
+		if calls++; calls == 1 {
+			panic("oops")
+		} else if calls < 4 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.Nil(t, g.Result())
+	assert.Equal(t, 4, calls)
+	assert.True(t, strings.HasPrefix(out.String(), "panic (flaky): oops\n"))
+	assert.Equal(t, 3, strings.Count(out.String(), "restart (flaky)"))
+
+	// 2. Check the restart intensity limit.
+	calls = 0
+	g.GoSupervised(context.Background(), "broken", policy, func(ctx context.Context) error {
+		calls++
+		return errors.New("failed")
+	})
+	assert.EqualError(t, g.Error(), "broken: restart intensity exceeded (3 restarts): failed")
+	assert.Equal(t, 4, calls)
+
+	// 3. Check the context cancellation.
+	ctx, cancel := context.WithCancel(context.Background())
+	policy.MaxRestarts = 0
+	g.GoSupervised(ctx, "loop", policy, func(ctx context.Context) error {
+		cancel()
+		return errors.New("failed")
+	})
+	assert.Nil(t, g.Result())
+
+	// 4. Check recovered panics are counted.
+	g = &Group{}
+	calls = 0
+	g.GoSupervised(context.Background(), "panic", policy, func(ctx context.Context) error {
+		if calls++; calls <= 2 {
+			panic("oops")
+		}
+		return nil
+	})
+	assert.Nil(t, g.Result())
+	stats := g.Stats()
+	assert.Equal(t, int64(2), stats.RecoveredPanics)
+	assert.Equal(t, int64(2), stats.Restarts)
+	assert.Equal(t, int64(0), stats.Panicked)
+	assert.Equal(t, int64(1), stats.Finished)
+}
+
+func TestGroupSupervisedBackoff(t *testing.T) {
+	var (
+		out    = &bytes.Buffer{}
+		g      = &Group{Logger: log.New(out, "", 0)}
+		policy = RestartPolicy{Backoff: Backoff{Initial: time.Millisecond, Multiplier: 10}, Period: 20 * time.Millisecond}
+		calls  int
+	)
+
+	// 1. Check the backoff grows with consecutive failures.
+	g.GoSupervised(context.Background(), "fast", policy, func(ctx context.Context) error {
+		if calls++; calls < 4 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.Nil(t, g.Result())
+	assert.Equal(t, `restart (fast) after 1ms: failed
+restart (fast) after 10ms: failed
+restart (fast) after 100ms: failed
+`, out.String())
+
+	// 2. Check the backoff starts over after a long enough run.
+	out.Reset()
+	calls = 0
+	g.GoSupervised(context.Background(), "slow", policy, func(ctx context.Context) error {
+		if calls++; calls < 4 {
+			time.Sleep(policy.Period)
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.Nil(t, g.Result())
+	assert.Equal(t, 3, strings.Count(out.String(), "restart (slow) after 1ms: failed"))
+}
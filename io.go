@@ -0,0 +1,89 @@
+// io.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+var (
+	// defaultBytesPool is used by Copy function, the size of byte slices
+	// is the same as the one allocated by io.Copy function.
+	defaultBytesPool = NewBytesPool(32 * 1024)
+
+	// defaultBufferPool is used by ReadAll function. Huge buffers won't be
+	// retained.
+	defaultBufferPool = func() *BufferPool {
+		bp := NewBufferPool()
+		bp.MaxSize = 64 * 1024
+		return bp
+	}()
+)
+
+// ReadLimitError is returned when the size of data exceeds the limit.
+type ReadLimitError struct {
+	// Limit represents the maximum number of bytes allowed.
+	Limit int64
+}
+
+// Error returns the message of the error.
+func (e *ReadLimitError) Error() string {
+	return fmt.Sprintf("read limit exceeded: more than %d bytes", e.Limit)
+}
+
+// Copy is the same as io.Copy function except for the buffer is fetched from
+// a default BytesPool instead of being allocated.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	return defaultBytesPool.Copy(dst, src)
+}
+
+// ReadAll reads from r until an error or EOF and returns the data it read.
+// Compared with io.ReadAll, the data is read into a pooled buffer at first,
+// so only the returned byte slice is allocated. If max is positive and the
+// size of data exceeds it, returns a *ReadLimitError.
+func ReadAll(r io.Reader, max int64) ([]byte, error) {
+	b, err := defaultBufferPool.ReadAll(r, max)
+	if err != nil {
+		return nil, err
+	}
+	defer defaultBufferPool.Put(b)
+	return append([]byte(nil), b.Bytes()...), nil
+}
+
+// Copy copies from src to dst until either EOF is reached on src or an error
+// occurs, which is the same as io.CopyBuffer function except for the buffer
+// is fetched from the pool.
+func (bp *BytesPool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	b := bp.get(1)
+	defer bp.Put(b)
+	return io.CopyBuffer(dst, src, b)
+}
+
+// ReadAll reads from r until an error or EOF into a buffer fetched from the
+// pool, the caller should put the buffer back after using it. If max is
+// positive and the size of data exceeds it, returns a *ReadLimitError. If
+// any error occurs, the buffer has been put back and nil will be returned.
+func (bp *BufferPool) ReadAll(r io.Reader, max int64) (*bytes.Buffer, error) {
+	b := bp.get(1)
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+
+	if _, err := b.ReadFrom(r); err != nil {
+		bp.Put(b)
+		return nil, err
+	}
+
+	if max > 0 && int64(b.Len()) > max {
+		bp.Put(b)
+		return nil, &ReadLimitError{max}
+	}
+	return b, nil
+}
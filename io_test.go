@@ -0,0 +1,103 @@
+// io_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopy(t *testing.T) {
+	data := make([]byte, 100*1024)
+	rand.Read(data)
+
+	w := &bytes.Buffer{}
+	n, err := Copy(&trivialWriter{w}, &trivialReader{bytes.NewReader(data)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, w.Bytes())
+
+	// The byte slice of BytesPool is put back even if the copy fails.
+	bp := NewBytesPool(1024)
+	bp.Debug = true
+	_, err = bp.Copy(&trivialWriter{w}, &trivialReader{io.MultiReader(
+		bytes.NewReader(data),
+		&failedReader{errors.New("failed")},
+	)})
+	assert.EqualError(t, err, "failed")
+	assert.Empty(t, bp.Leaks())
+}
+
+func TestReadAll(t *testing.T) {
+	for _, cs := range []struct {
+		Data  string `json:"data"`
+		Max   int64  `json:"max"`
+		Error string `json:"error"`
+	}{
+		{"", 0, ""},
+		{"Hello, World!", 0, ""},
+		{"Hello, World!", 13, ""},
+		{"Hello, World!", 12, "read limit exceeded: more than 12 bytes"},
+		{strings.Repeat("a", 100000), 100000, ""},
+		{strings.Repeat("a", 100001), 100000, "read limit exceeded: more than 100000 bytes"},
+	} {
+		t.Run(encodeCase(cs), func(t *testing.T) {
+			data, err := ReadAll(strings.NewReader(cs.Data), cs.Max)
+			if cs.Error != "" {
+				assert.EqualError(t, err, cs.Error)
+				var le *ReadLimitError
+				assert.True(t, errors.As(err, &le))
+				assert.Equal(t, cs.Max, le.Limit)
+				assert.Nil(t, data)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cs.Data, string(data))
+			}
+		})
+	}
+
+	// The buffer is put back when the read fails.
+	bp := NewBufferPool()
+	bp.Debug = true
+	b, err := bp.ReadAll(&failedReader{errors.New("failed")}, 0)
+	assert.Nil(t, b)
+	assert.EqualError(t, err, "failed")
+	assert.Empty(t, bp.Leaks())
+
+	b, err = bp.ReadAll(strings.NewReader("foo"), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", b.String())
+	assert.Equal(t, 1, len(bp.Leaks()))
+	assert.Contains(t, bp.Leaks()[0], "io_test.go")
+	bp.Put(b)
+	assert.Empty(t, bp.Leaks())
+
+	// The buffer of a large read isn't retained by the default pool.
+	data, err := ReadAll(bytes.NewReader(make([]byte, 1024*1024)), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1024*1024, len(data))
+	for i := 0; i < 10; i++ {
+		b := defaultBufferPool.Get()
+		assert.True(t, b.Cap() <= defaultBufferPool.MaxSize)
+		defer defaultBufferPool.Put(b)
+	}
+}
+
+type failedReader struct {
+	err error
+}
+
+func (fr *failedReader) Read(b []byte) (int, error) {
+	return 0, fr.err
+}
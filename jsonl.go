@@ -0,0 +1,175 @@
+// jsonl.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JsonLinesWriter writes records to an underlying io.Writer in the JSON Lines
+// (newline-delimited JSON) format. Each record is encoded in the same way as
+// ToJson function, so HTML characters are not escaped. It's not safe for
+// concurrent use.
+type JsonLinesWriter struct {
+	// BufferSize enables buffering if it's positive. In this case, records are
+	// accumulated in a buffer fetched from a BufferPool and written to the
+	// underlying io.Writer once the size of the buffer reaches BufferSize,
+	// the caller must call Flush method after the last record is written.
+	// Otherwise, each record is written by a single Write call.
+	BufferSize int
+
+	w   io.Writer
+	buf *bytes.Buffer
+}
+
+// NewJsonLinesWriter creates a JsonLinesWriter instance which writes to w.
+func NewJsonLinesWriter(w io.Writer) *JsonLinesWriter {
+	return &JsonLinesWriter{w: w}
+}
+
+// Write writes the JSON encoding of v followed by a newline character. If v
+// can't be encoded, nothing will be written.
+func (jw *JsonLinesWriter) Write(v interface{}) error {
+	o := JsonEncodeOptions{TrailingNewline: true}
+	if jw.BufferSize <= 0 {
+		return o.Encode(jw.w, v)
+	}
+
+	if jw.buf == nil {
+		jw.buf = jsonBufferPool.Get()
+	}
+
+	if err := o.Encode(jw.buf, v); err != nil {
+		return err
+	}
+
+	if jw.buf.Len() >= jw.BufferSize {
+		return jw.flush()
+	}
+	return nil
+}
+
+// Flush writes any buffered records to the underlying io.Writer and puts the
+// buffer back to the pool. It does nothing if the buffering is disabled.
+func (jw *JsonLinesWriter) Flush() error {
+	if jw.buf == nil {
+		return nil
+	}
+
+	err := jw.flush()
+	if jw.buf.Len() == 0 {
+		jsonBufferPool.Put(jw.buf)
+		jw.buf = nil
+	}
+	return err
+}
+
+// flush writes buffered records to the underlying io.Writer. Records which
+// haven't been written are retained in the buffer if any error occurs.
+func (jw *JsonLinesWriter) flush() error {
+	_, err := jw.buf.WriteTo(jw.w)
+	return err
+}
+
+// JsonLinesReader reads records from an underlying io.Reader in the JSON Lines
+// (newline-delimited JSON) format. Blank lines are skipped.
+type JsonLinesReader struct {
+	// Options specifies how to decode each record. DisallowTrailingData is
+	// always enabled because a line can only contain one JSON value.
+	Options JsonDecodeOptions
+
+	scanner *bufio.Scanner
+	max     int
+	line    int
+	err     error
+}
+
+// NewJsonLinesReader creates a JsonLinesReader instance which reads from r. The
+// max parameter limits the length of a line (excluding the newline character).
+// If it's not positive, bufio.MaxScanTokenSize is used.
+func NewJsonLinesReader(r io.Reader, max int) *JsonLinesReader {
+	if max <= 0 {
+		max = bufio.MaxScanTokenSize
+	}
+
+	size := 4096
+	if size > max+1 {
+		size = max + 1
+	}
+
+	scanner := bufio.NewScanner(r)
+	// One more byte is reserved for the newline character.
+	scanner.Buffer(make([]byte, 0, size), max+1)
+	return &JsonLinesReader{scanner: scanner, max: max}
+}
+
+// Next decodes the next record into v. It returns io.EOF when there are no
+// more records. Other errors are reported as a *JsonLinesError which contains
+// the line number. Errors of reading the underlying io.Reader or the length of
+// a line exceeding the limit are permanent, but a record which can't be
+// decoded doesn't prevent reading the subsequent ones.
+func (jr *JsonLinesReader) Next(v interface{}) error {
+	if jr.err != nil {
+		return jr.err
+	}
+
+	for jr.scanner.Scan() {
+		jr.line++
+		data := bytes.TrimSpace(jr.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		opt := jr.Options
+		opt.DisallowTrailingData = true
+		if err := FromJson(data, v, opt); err != nil {
+			return &JsonLinesError{Line: jr.line, Err: err}
+		}
+		return nil
+	}
+
+	err := jr.scanner.Err()
+	switch {
+	case err == nil:
+		jr.err = io.EOF
+	case errors.Is(err, bufio.ErrTooLong):
+		jr.err = &JsonLinesError{Line: jr.line + 1, Err: &ReadLimitError{int64(jr.max)}}
+	default:
+		jr.err = &JsonLinesError{Line: jr.line + 1, Err: err}
+	}
+	return jr.err
+}
+
+// Line returns the line number of the last record read by Next method. Line
+// numbers start at 1.
+func (jr *JsonLinesReader) Line() int {
+	return jr.line
+}
+
+// JsonLinesError describes a failure of reading a JSON Lines record.
+type JsonLinesError struct {
+	// Line represents the line number at which the error occurs.
+	Line int
+
+	// Err represents the underlying error.
+	Err error
+}
+
+// Error returns the message of the error.
+func (e *JsonLinesError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *JsonLinesError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,144 @@
+// jsonl_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonLinesWriter(t *testing.T) {
+	records := []interface{}{
+		map[string]interface{}{"url": "/foo?a=1&b=2", "status": 200},
+		"line1\nline2",
+		[]int{1, 2, 3},
+		nil,
+	}
+	output := `{"status":200,"url":"/foo?a=1&b=2"}` + "\n" + `"line1\nline2"` + "\n" + `[1,2,3]` + "\n" + `null` + "\n"
+
+	for _, size := range []int{0, 1, 20, 4096} {
+		w := &bytes.Buffer{}
+		jw := NewJsonLinesWriter(w)
+		jw.BufferSize = size
+		for _, record := range records {
+			assert.NoError(t, jw.Write(record))
+		}
+
+		// A record which can't be encoded is skipped.
+		assert.Error(t, jw.Write(make(chan int)))
+		if size > len(output) {
+			assert.Equal(t, 0, w.Len())
+		}
+
+		assert.NoError(t, jw.Flush())
+		assert.Equal(t, output, w.String())
+		assert.NoError(t, jw.Flush())
+	}
+
+	// Records are retained if the underlying writer fails.
+	jw := NewJsonLinesWriter(&limitedWriter{0})
+	jw.BufferSize = 1024
+	assert.NoError(t, jw.Write(1))
+	assert.Equal(t, io.ErrShortWrite, jw.Flush())
+	assert.NotNil(t, jw.buf)
+	jw.w = &bytes.Buffer{}
+	assert.NoError(t, jw.Flush())
+	assert.Equal(t, "1\n", jw.w.(*bytes.Buffer).String())
+}
+
+func TestJsonLinesReader(t *testing.T) {
+	type record struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	input := `{"name":"foo","age":10}` + "\n" +
+		"\n" +
+		`  {"name":"bar","age":20}  ` + "\r\n" +
+		`{"name":"baz","age":"30"}` + "\n" +
+		`{"name":"qux","age":40} {}` + "\n" +
+		`{"name":"quux","age":50,"extra":1}` + "\n" +
+		`{"name":"last","age":60}`
+
+	jr := NewJsonLinesReader(strings.NewReader(input), 0)
+	jr.Options.DisallowUnknownFields = true
+
+	var r record
+	assert.NoError(t, jr.Next(&r))
+	assert.Equal(t, record{"foo", 10}, r)
+	assert.Equal(t, 1, jr.Line())
+
+	assert.NoError(t, jr.Next(&r))
+	assert.Equal(t, record{"bar", 20}, r)
+	assert.Equal(t, 3, jr.Line())
+
+	for _, line := range []int{4, 5, 6} {
+		err := jr.Next(&record{})
+		var je *JsonLinesError
+		assert.True(t, errors.As(err, &je))
+		assert.Equal(t, line, je.Line)
+		assert.True(t, strings.HasPrefix(err.Error(), "line "))
+
+		var de *JsonDecodeError
+		assert.True(t, errors.As(err, &de))
+	}
+
+	assert.NoError(t, jr.Next(&r))
+	assert.Equal(t, record{"last", 60}, r)
+	assert.Equal(t, 7, jr.Line())
+
+	assert.Equal(t, io.EOF, jr.Next(&r))
+	assert.Equal(t, io.EOF, jr.Next(&r))
+
+	// Read records written by JsonLinesWriter.
+	w := &bytes.Buffer{}
+	jw := NewJsonLinesWriter(w)
+	for i := 0; i < 100; i++ {
+		jw.Write(record{strings.Repeat("a", i), i})
+	}
+
+	jr = NewJsonLinesReader(w, 0)
+	for i := 0; ; i++ {
+		var r record
+		err := jr.Next(&r)
+		if err == io.EOF {
+			assert.Equal(t, 100, i)
+			break
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, record{strings.Repeat("a", i), i}, r)
+	}
+}
+
+func TestJsonLinesReaderMaxLine(t *testing.T) {
+	input := `"12345678"` + "\n" + `"123456789"` + "\n" + `"1"` + "\n"
+
+	jr := NewJsonLinesReader(strings.NewReader(input), 10)
+	var s string
+	assert.NoError(t, jr.Next(&s))
+	assert.Equal(t, "12345678", s)
+
+	err := jr.Next(&s)
+	assert.EqualError(t, err, "line 2: read limit exceeded: more than 10 bytes")
+	var le *ReadLimitError
+	assert.True(t, errors.As(err, &le))
+
+	// The error is permanent.
+	assert.Equal(t, err, jr.Next(&s))
+
+	// Errors of the underlying reader.
+	jr = NewJsonLinesReader(io.MultiReader(strings.NewReader("1\n"), &failedReader{errors.New("failed")}), 0)
+	var n int
+	assert.NoError(t, jr.Next(&n))
+	assert.EqualError(t, jr.Next(&n), "line 2: failed")
+}
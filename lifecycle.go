@@ -0,0 +1,201 @@
+// lifecycle.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+)
+
+// Lifecycle coordinates the startup and the shutdown of long-running
+// components (like servers and background loops). All components are
+// started simultaneously by Run method, and they are stopped in reverse
+// order of registration when a signal is received, the context is done,
+// or any component fails.
+type Lifecycle struct {
+	components []lifecycleComponent
+
+	// ShutdownTimeout specifies the maximum duration of the shutdown process,
+	// including calling Stop functions and waiting for Start functions to
+	// return. If it's not positive, there is no deadline.
+	ShutdownTimeout time.Duration
+
+	// Signals specifies signals which trigger the shutdown. If it's nil,
+	// SIGINT and SIGTERM will be used.
+	Signals []os.Signal
+
+	// Logger specifies an optional logger for unexpected behaviors, which
+	// lead to panic, from callback functions.
+	Logger *log.Logger
+}
+
+// lifecycleComponent represents a component registered to Lifecycle.
+type lifecycleComponent struct {
+	name  string
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+// lifecycleExit represents the return of a Start function.
+type lifecycleExit struct {
+	name string
+	err  error
+}
+
+// Register adds a component to the Lifecycle. The start function should
+// block until the component stops, and it should return when the context
+// is cancelled. A non-nil error (or a panic) returned by start triggers the
+// shutdown of all components. The stop function is optional, it's called
+// during the shutdown with a context which carries the shutdown deadline.
+// Register can't be called after Run method has been called.
+func (l *Lifecycle) Register(name string, start, stop func(ctx context.Context) error) {
+	l.components = append(l.components, lifecycleComponent{name, start, stop})
+}
+
+// Run starts all components and blocks until the shutdown is completed.
+// Errors of all components (wrapped as *TaskError with their names) are
+// merged into a single error by ListErrorFormatter. If the shutdown is
+// triggered by a signal or the context and all components stop normally,
+// returns nil.
+func (l *Lifecycle) Run(ctx context.Context) error {
+	sigs := l.Signals
+	if sigs == nil {
+		sigs = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, sigs...)
+	defer signal.Stop(sigch)
+
+	var (
+		es      []error
+		running = len(l.components)
+		exits   = make(chan lifecycleExit, len(l.components))
+	)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for _, c := range l.components {
+		go func(c lifecycleComponent) {
+			exits <- lifecycleExit{c.name, l.call(runCtx, c.name, "start", c.start)}
+		}(c)
+	}
+
+wait:
+	for running > 0 {
+		select {
+		case sig := <-sigch:
+			if l.Logger != nil {
+				l.Logger.Printf("received signal %s, shutting down", sig)
+			}
+			break wait
+		case <-ctx.Done():
+			break wait
+		case exit := <-exits:
+			running--
+			if exit.err != nil {
+				es = append(es, wrapTaskError(exit.name, exit.err))
+				break wait
+			}
+		}
+	}
+	cancel()
+
+	stopCtx := context.Background()
+	if l.ShutdownTimeout > 0 {
+		var stopCancel context.CancelFunc
+		stopCtx, stopCancel = context.WithTimeout(stopCtx, l.ShutdownTimeout)
+		defer stopCancel()
+	}
+
+	// Stop functions are called in separate goroutines, so the ones ignoring
+	// the context can't block the shutdown beyond the deadline. Once the
+	// deadline has passed, remaining Stop functions are skipped and each of
+	// them is reported.
+	for i := len(l.components) - 1; i >= 0; i-- {
+		c := l.components[i]
+		if c.stop == nil {
+			continue
+		}
+
+		if err := stopCtx.Err(); err != nil {
+			es = append(es, wrapTaskError(c.name, fmt.Errorf("stop skipped: %w", err)))
+			continue
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- l.call(stopCtx, c.name, "stop", c.stop)
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				es = append(es, wrapTaskError(c.name, err))
+			}
+		case <-stopCtx.Done():
+			es = append(es, wrapTaskError(c.name, fmt.Errorf("stop timeout: %w", stopCtx.Err())))
+		}
+	}
+
+	collect := func(exit lifecycleExit) {
+		running--
+		// Ignore the context error returned by Start functions cause
+		// it's caused by the shutdown.
+		if exit.err != nil && !errors.Is(exit.err, runCtx.Err()) {
+			es = append(es, wrapTaskError(exit.name, exit.err))
+		}
+	}
+
+	for running > 0 {
+		select {
+		case exit := <-exits:
+			collect(exit)
+		case <-stopCtx.Done():
+			// Collect Start functions which have returned before the deadline.
+		drain:
+			for running > 0 {
+				select {
+				case exit := <-exits:
+					collect(exit)
+				default:
+					break drain
+				}
+			}
+
+			if running > 0 {
+				es = append(es, fmt.Errorf("shutdown timeout: %d components are still running", running))
+				running = 0
+			}
+		}
+	}
+
+	return ListErrorFormatter(es)
+}
+
+// call calls the start or stop function of a component and recovers the
+// panic caused by it.
+func (l *Lifecycle) call(ctx context.Context, name, phase string, fn func(context.Context) error) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("%v", x)
+			if l.Logger != nil {
+				l.Logger.Printf("panic (%s %s): %v\n%s", name, phase, x, debug.Stack())
+			}
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,139 @@
+// lifecycle_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lifecycleRecorder records the order of stop functions.
+type lifecycleRecorder struct {
+	locker sync.Mutex
+	stops  []string
+}
+
+func (lr *lifecycleRecorder) register(l *Lifecycle, name string, startErr error) {
+	l.Register(name, func(ctx context.Context) error {
+		if startErr != nil {
+			return startErr
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(ctx context.Context) error {
+		lr.locker.Lock()
+		lr.stops = append(lr.stops, name)
+		lr.locker.Unlock()
+		return nil
+	})
+}
+
+func TestLifecycle(t *testing.T) {
+	// 1. Check shutdown triggered by the context.
+	var (
+		lr = &lifecycleRecorder{}
+		l  = &Lifecycle{}
+	)
+	lr.register(l, "a", nil)
+	lr.register(l, "b", nil)
+	lr.register(l, "c", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, l.Run(ctx))
+	assert.Equal(t, []string{"c", "b", "a"}, lr.stops)
+
+	// 2. Check shutdown triggered by a failed component.
+	lr = &lifecycleRecorder{}
+	l = &Lifecycle{}
+	lr.register(l, "a", nil)
+	lr.register(l, "b", errors.New("failed"))
+	l.Register("c", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}, func(ctx context.Context) error {
+		panic("oops")
+	})
+
+	assert.EqualError(t, l.Run(context.Background()), `multiple (2) errors:
+   1. b: failed
+   2. c: oops`)
+	assert.Equal(t, []string{"b", "a"}, lr.stops)
+
+	// 3. Check shutdown triggered by a signal.
+	lr = &lifecycleRecorder{}
+	l = &Lifecycle{Signals: []os.Signal{os.Interrupt}}
+	lr.register(l, "a", nil)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p, _ := os.FindProcess(os.Getpid())
+		p.Signal(os.Interrupt)
+	}()
+	assert.NoError(t, l.Run(context.Background()))
+	assert.Equal(t, []string{"a"}, lr.stops)
+}
+
+func TestLifecycleShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	l := &Lifecycle{ShutdownTimeout: 50 * time.Millisecond}
+	l.Register("stubborn", func(ctx context.Context) error {
+		<-release
+		return nil
+	}, nil)
+	l.Register("panic", func(ctx context.Context) error {
+		panic("oops")
+	}, nil)
+
+	assert.EqualError(t, l.Run(context.Background()), `multiple (2) errors:
+   1. panic: oops
+   2. shutdown timeout: 1 components are still running`)
+}
+
+func TestLifecycleStopTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var stopped bool
+	l := &Lifecycle{ShutdownTimeout: 50 * time.Millisecond}
+	l.Register("first", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	l.Register("hang", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(ctx context.Context) error {
+		// Ignore the context.
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	begin := time.Now()
+	err := l.Run(ctx)
+	assert.True(t, time.Since(begin) < time.Second)
+	assert.EqualError(t, err, `multiple (2) errors:
+   1. hang: stop timeout: context deadline exceeded
+   2. first: stop skipped: context deadline exceeded`)
+
+	// The remaining Stop functions are skipped.
+	assert.False(t, stopped)
+}
@@ -0,0 +1,411 @@
+// limiter.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Clock is an interface which provides the current time and timers. The
+// main purpose of it is to inject a fake clock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current
+	// time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock implemented by time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// getClock returns the clock itself if it's not nil, otherwise returns the
+// system clock.
+func getClock(c Clock) Clock {
+	if c == nil {
+		return systemClock{}
+	}
+	return c
+}
+
+// InfRate is the infinite rate limit, which allows all events. Rates greater
+// than or equal to it (including math.Inf(1)) are also infinite.
+const InfRate = math.MaxFloat64
+
+// Limiter is a token bucket rate limiter. The bucket is filled with tokens
+// at the specified rate (tokens per second) and its capacity is the burst
+// size. Initially, the bucket is full. Each event consumes a token.
+type Limiter struct {
+	locker sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time // The last time tokens field was updated.
+	event  time.Time // The latest time of events of reservations.
+
+	// Clock specifies an optional clock used by the limiter. If it's nil,
+	// the system clock will be used. It can't be changed after the limiter
+	// has been used.
+	Clock Clock
+}
+
+// NewLimiter creates a Limiter instance which allows events up to the rate
+// (per second) and permits bursts of at most burst events.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{rate: rate, burst: burst, tokens: float64(burst)}
+}
+
+// Rate returns the current rate limit.
+func (l *Limiter) Rate() float64 {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	return l.rate
+}
+
+// Burst returns the current burst size.
+func (l *Limiter) Burst() int {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	return l.burst
+}
+
+// SetRate updates the rate limit. Tokens accumulated at the old rate are
+// reserved.
+func (l *Limiter) SetRate(rate float64) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	l.advance(getClock(l.Clock).Now())
+	l.rate = rate
+}
+
+// SetBurst updates the burst size.
+func (l *Limiter) SetBurst(burst int) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	l.advance(getClock(l.Clock).Now())
+	l.burst = burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+}
+
+// Allow reports whether an event may happen now, it's the shorthand for AllowN(1).
+func (l *Limiter) Allow() bool {
+	return l.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now. If so, n tokens are consumed.
+func (l *Limiter) AllowN(n int) bool {
+	return l.reserve(getClock(l.Clock).Now(), n, 0).ok
+}
+
+// Reserve is the shorthand for ReserveN(1).
+func (l *Limiter) Reserve() *Reservation {
+	return l.ReserveN(1)
+}
+
+// ReserveN reserves n tokens and returns a Reservation which indicates how
+// long the caller must wait before n events happen. If n exceeds the burst
+// size (or the rate is zero and there are no enough tokens), the returned
+// Reservation is not OK.
+func (l *Limiter) ReserveN(n int) *Reservation {
+	return l.reserve(getClock(l.Clock).Now(), n, time.Duration(math.MaxInt64))
+}
+
+// Wait is the shorthand for WaitN(ctx, 1).
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n events may happen. It returns an error if n exceeds
+// the burst size, or the context is done, or the expected wait time exceeds
+// the deadline of the context.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	var (
+		clock   = getClock(l.Clock)
+		now     = clock.Now()
+		maxWait = time.Duration(math.MaxInt64)
+	)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = deadline.Sub(now)
+	}
+
+	r := l.reserve(now, n, maxWait)
+	if !r.ok {
+		return fmt.Errorf("rate limit: wait(n=%d) exceeds burst or context deadline", n)
+	}
+
+	d := r.at.Sub(now)
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve is the underlying implementation of AllowN, ReserveN and WaitN. The
+// maxWait parameter specifies the maximum duration the caller can wait.
+func (l *Limiter) reserve(now time.Time, n int, maxWait time.Duration) *Reservation {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.rate >= InfRate {
+		return &Reservation{ok: true, l: l, n: 0, at: now}
+	}
+
+	if n > l.burst {
+		return &Reservation{l: l}
+	}
+
+	l.advance(now)
+
+	var wait time.Duration
+	if tokens := l.tokens - float64(n); tokens < 0 {
+		if l.rate <= 0 {
+			return &Reservation{l: l}
+		}
+
+		seconds := -tokens / l.rate
+		if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+			return &Reservation{l: l}
+		}
+		wait = time.Duration(seconds * float64(time.Second))
+	}
+
+	if wait > maxWait {
+		return &Reservation{l: l}
+	}
+
+	at := now.Add(wait)
+	if at.After(l.event) {
+		l.event = at
+	}
+
+	l.tokens -= float64(n)
+	return &Reservation{ok: true, l: l, n: n, at: at}
+}
+
+// advance fills the bucket with tokens accumulated since the last update.
+func (l *Limiter) advance(now time.Time) {
+	if l.last.IsZero() {
+		l.last = now
+		return
+	}
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+		l.last = now
+	}
+}
+
+// Reservation holds information about events that are permitted by a Limiter
+// after a delay.
+type Reservation struct {
+	ok bool
+	l  *Limiter
+	n  int
+	at time.Time
+}
+
+// OK reports whether the limiter can provide the requested tokens. If it's
+// false, Delay returns a huge value and Cancel does nothing.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns the duration for which the caller must wait before the
+// reserved events happen.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return time.Duration(math.MaxInt64)
+	}
+
+	if d := r.at.Sub(getClock(r.l.Clock).Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Cancel indicates the reserved events won't happen, so the reserved tokens
+// are returned to the limiter if the reservation hasn't been due. Tokens which
+// have been reserved by later reservations (against the debt of this one) are
+// not returned, otherwise later events would happen at the same time.
+func (r *Reservation) Cancel() {
+	if !r.ok || r.n == 0 {
+		return
+	}
+
+	l := r.l
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	now := getClock(l.Clock).Now()
+	if !r.at.After(now) {
+		return
+	}
+
+	// Tokens reserved after this reservation can't be returned.
+	restore := float64(r.n) - l.event.Sub(r.at).Seconds()*l.rate
+	r.n = 0
+	if restore <= 0 {
+		return
+	}
+
+	l.advance(now)
+	l.tokens += restore
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+
+	// This is the latest reservation, so the latest event goes back to the
+	// time before it was made.
+	if r.at.Equal(l.event) && l.rate > 0 {
+		prev := r.at.Add(-time.Duration(restore / l.rate * float64(time.Second)))
+		if !prev.Before(now) {
+			l.event = prev
+		}
+	}
+}
+
+// KeyedLimiter maintains a separate Limiter for each key (like a client IP).
+// Limiters which haven't been used for a while are evicted.
+type KeyedLimiter struct {
+	locker    sync.Mutex
+	rate      float64
+	burst     int
+	idle      time.Duration
+	limiters  map[string]*keyedLimiter
+	lastSweep time.Time
+
+	// Clock specifies an optional clock used by the limiter and all limiters
+	// of keys. If it's nil, the system clock will be used. It can't be changed
+	// after the limiter has been used.
+	Clock Clock
+}
+
+// keyedLimiter is an item of KeyedLimiter.
+type keyedLimiter struct {
+	*Limiter
+	used time.Time
+}
+
+// NewKeyedLimiter creates a KeyedLimiter instance. The rate and the burst
+// parameters are used to create the Limiter of each key. The idle parameter
+// specifies how long a unused Limiter is retained; if it's not positive,
+// Limiters are never evicted.
+func NewKeyedLimiter(rate float64, burst int, idle time.Duration) *KeyedLimiter {
+	return &KeyedLimiter{
+		rate:     rate,
+		burst:    burst,
+		idle:     idle,
+		limiters: make(map[string]*keyedLimiter),
+	}
+}
+
+// Get returns the Limiter of the key, it will be created if not exists.
+func (kl *KeyedLimiter) Get(key string) *Limiter {
+	kl.locker.Lock()
+	defer kl.locker.Unlock()
+
+	now := getClock(kl.Clock).Now()
+	kl.sweep(now)
+
+	item, ok := kl.limiters[key]
+	if !ok {
+		l := NewLimiter(kl.rate, kl.burst)
+		l.Clock = kl.Clock
+		item = &keyedLimiter{Limiter: l}
+		kl.limiters[key] = item
+	}
+	item.used = now
+	return item.Limiter
+}
+
+// Allow reports whether an event of the key may happen now.
+func (kl *KeyedLimiter) Allow(key string) bool {
+	return kl.Get(key).Allow()
+}
+
+// Wait blocks until an event of the key may happen.
+func (kl *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	return kl.Get(key).Wait(ctx)
+}
+
+// AllowRequest reports whether a HTTP request may happen now. The key of the
+// request is its client ip returned by GetClientIP function, so the security
+// implications of it also apply here.
+func (kl *KeyedLimiter) AllowRequest(r *http.Request) bool {
+	return kl.Allow(GetClientIP(r))
+}
+
+// SetRate updates the rate limit of all keys.
+func (kl *KeyedLimiter) SetRate(rate float64) {
+	kl.locker.Lock()
+	defer kl.locker.Unlock()
+
+	kl.rate = rate
+	for _, item := range kl.limiters {
+		item.SetRate(rate)
+	}
+}
+
+// SetBurst updates the burst size of all keys.
+func (kl *KeyedLimiter) SetBurst(burst int) {
+	kl.locker.Lock()
+	defer kl.locker.Unlock()
+
+	kl.burst = burst
+	for _, item := range kl.limiters {
+		item.SetBurst(burst)
+	}
+}
+
+// Len returns the number of keys whose Limiters are retained.
+func (kl *KeyedLimiter) Len() int {
+	kl.locker.Lock()
+	defer kl.locker.Unlock()
+	return len(kl.limiters)
+}
+
+// sweep evicts idle Limiters. To avoid scanning all keys on every call, it
+// only works once per idle duration.
+func (kl *KeyedLimiter) sweep(now time.Time) {
+	if kl.idle <= 0 || now.Sub(kl.lastSweep) < kl.idle {
+		return
+	}
+
+	for key, item := range kl.limiters {
+		if now.Sub(item.used) >= kl.idle {
+			delete(kl.limiters, key)
+		}
+	}
+	kl.lastSweep = now
+}
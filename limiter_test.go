@@ -0,0 +1,199 @@
+// limiter_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock whose time only changes when Advance or After method
+// is called. After method advances the time immediately.
+type fakeClock struct {
+	locker sync.Mutex
+	now    time.Time
+	waits  []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.locker.Lock()
+	defer fc.locker.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) After(d time.Duration) <-chan time.Time {
+	fc.locker.Lock()
+	defer fc.locker.Unlock()
+	fc.now = fc.now.Add(d)
+	fc.waits = append(fc.waits, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- fc.now
+	return ch
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.locker.Lock()
+	defer fc.locker.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+func TestLimiter(t *testing.T) {
+	var (
+		clock = newFakeClock()
+		l     = NewLimiter(10, 5)
+	)
+	l.Clock = clock
+
+	// 1. Check the bucket is full initially.
+	for i := 0; i < 5; i++ {
+		assert.True(t, l.Allow())
+	}
+	assert.False(t, l.Allow())
+
+	// 2. Check tokens are refilled at the rate.
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+
+	clock.Advance(time.Hour)
+	assert.True(t, l.AllowN(5))
+	assert.False(t, l.AllowN(6))
+
+	// 3. Check reservations.
+	r := l.Reserve()
+	assert.True(t, r.OK())
+	assert.Equal(t, 100*time.Millisecond, r.Delay())
+	r.Cancel()
+	assert.False(t, l.Allow())
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, l.Allow())
+	assert.False(t, l.ReserveN(6).OK())
+
+	// Tokens reserved by later reservations aren't returned by Cancel.
+	l2 := NewLimiter(10, 1)
+	l2.Clock = clock
+	assert.True(t, l2.Allow())
+	r1, r2 := l2.Reserve(), l2.Reserve()
+	assert.Equal(t, 100*time.Millisecond, r1.Delay())
+	assert.Equal(t, 200*time.Millisecond, r2.Delay())
+	r1.Cancel()
+	r3 := l2.Reserve()
+	assert.Equal(t, 300*time.Millisecond, r3.Delay())
+
+	// The latest reservation returns its tokens.
+	r3.Cancel()
+	assert.Equal(t, 300*time.Millisecond, l2.Reserve().Delay())
+
+	// 4. Check dynamic updates.
+	l.SetRate(100)
+	clock.Advance(10 * time.Millisecond)
+	assert.True(t, l.Allow())
+	assert.Equal(t, float64(100), l.Rate())
+
+	l.SetBurst(1)
+	clock.Advance(time.Hour)
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+	assert.Equal(t, 1, l.Burst())
+
+	l.SetRate(0)
+	clock.Advance(time.Hour)
+	assert.False(t, l.Allow())
+	assert.False(t, l.Reserve().OK())
+
+	l.SetRate(InfRate)
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.Allow())
+	}
+
+	l.SetRate(math.Inf(1))
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.Allow())
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	var (
+		clock = newFakeClock()
+		l     = NewLimiter(10, 1)
+	)
+	l.Clock = clock
+
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, clock.waits)
+
+	// Exceed the burst size.
+	assert.Error(t, l.WaitN(context.Background(), 2))
+
+	// Exceed the deadline of the context.
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(50*time.Millisecond))
+	defer cancel()
+	assert.Error(t, l.Wait(ctx))
+
+	// The context is done.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, l.Wait(ctx))
+
+	// Check the system clock.
+	l = NewLimiter(100, 1)
+	begin := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, l.Wait(context.Background()))
+	}
+	assert.True(t, time.Since(begin) >= 30*time.Millisecond)
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	var (
+		clock = newFakeClock()
+		kl    = NewKeyedLimiter(1, 2, time.Minute)
+	)
+	kl.Clock = clock
+
+	// 1. Check keys are limited separately.
+	assert.True(t, kl.Allow("a"))
+	assert.True(t, kl.Allow("a"))
+	assert.False(t, kl.Allow("a"))
+	assert.True(t, kl.Allow("b"))
+	assert.Equal(t, 2, kl.Len())
+
+	// 2. Check HTTP requests are limited by the client ip.
+	r := &http.Request{RemoteAddr: "183.91.1.19:80"}
+	assert.True(t, kl.AllowRequest(r))
+	assert.True(t, kl.AllowRequest(r))
+	assert.False(t, kl.AllowRequest(r))
+	assert.False(t, kl.Allow("183.91.1.19"))
+
+	// 3. Check dynamic updates.
+	kl.SetBurst(1)
+	kl.SetRate(InfRate)
+	assert.True(t, kl.Allow("a"))
+	assert.True(t, kl.Get("c").Allow())
+	kl.SetRate(1)
+
+	// 4. Check idle keys are evicted.
+	clock.Advance(30 * time.Second)
+	kl.Get("a")
+	clock.Advance(40 * time.Second)
+	kl.Get("d")
+	assert.Equal(t, 2, kl.Len())
+}
@@ -0,0 +1,249 @@
+// pipeline.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// Pipeline is a series of stages connected by bounded channels. The first
+// stage must be a source which generates values, and each following stage
+// receives values from the previous one and sends values to the next one.
+// All stages run simultaneously, and if any stage fails, the remaining ones
+// will be cancelled.
+type Pipeline struct {
+	size   int
+	stages []pipelineStage
+
+	// Logger specifies an optional logger for unexpected behaviors, which
+	// lead to panic, from callback functions.
+	Logger *log.Logger
+}
+
+// pipelineStage represents a stage of a Pipeline. The fn function will be
+// executed by the specified number of workers simultaneously.
+type pipelineStage struct {
+	source  bool
+	workers int
+	fn      func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error
+}
+
+// NewPipeline creates a Pipeline instance. The size parameter specifies the
+// capacity of the channels between stages, it can't be negative.
+func NewPipeline(size int) *Pipeline {
+	return &Pipeline{size: size}
+}
+
+// Source adds a stage which generates values by calling the emit function.
+// The emit function returns an error when the pipeline has been cancelled,
+// the source function should return as soon as possible in this case.
+func (p *Pipeline) Source(fn func(ctx context.Context, emit func(interface{}) error) error) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{true, 1, func(ctx context.Context, _ <-chan interface{}, out chan<- interface{}) error {
+		return fn(ctx, func(v interface{}) error {
+			return pipelineSend(ctx, out, v)
+		})
+	}})
+	return p
+}
+
+// Map adds a stage which converts each value by the fn function, the number
+// of workers executing the function simultaneously is specified by the workers
+// parameter. Values might be reordered if workers is greater than one.
+func (p *Pipeline) Map(workers int, fn func(ctx context.Context, v interface{}) (interface{}, error)) *Pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p.stages = append(p.stages, pipelineStage{false, workers, func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+		return pipelineRange(ctx, in, func(v interface{}) error {
+			res, err := fn(ctx, v)
+			if err != nil {
+				return err
+			}
+			return pipelineSend(ctx, out, res)
+		})
+	}})
+	return p
+}
+
+// Filter adds a stage which only passes values satisfying the fn function.
+func (p *Pipeline) Filter(fn func(v interface{}) bool) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{false, 1, func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+		return pipelineRange(ctx, in, func(v interface{}) error {
+			if !fn(v) {
+				return nil
+			}
+			return pipelineSend(ctx, out, v)
+		})
+	}})
+	return p
+}
+
+// Batch adds a stage which groups every n values into a []interface{}. The
+// last batch might contain less than n values.
+func (p *Pipeline) Batch(n int) *Pipeline {
+	if n < 1 {
+		n = 1
+	}
+
+	p.stages = append(p.stages, pipelineStage{false, 1, func(ctx context.Context, in <-chan interface{}, out chan<- interface{}) error {
+		batch := make([]interface{}, 0, n)
+		err := pipelineRange(ctx, in, func(v interface{}) error {
+			if batch = append(batch, v); len(batch) < n {
+				return nil
+			}
+			full := batch
+			batch = make([]interface{}, 0, n)
+			return pipelineSend(ctx, out, full)
+		})
+
+		if err == nil && len(batch) > 0 {
+			err = pipelineSend(ctx, out, batch)
+		}
+		return err
+	}})
+	return p
+}
+
+// Sink adds a stage which consumes each value by the fn function. It should
+// be the last stage, cause it doesn't send any value to the next stage.
+func (p *Pipeline) Sink(fn func(ctx context.Context, v interface{}) error) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{false, 1, func(ctx context.Context, in <-chan interface{}, _ chan<- interface{}) error {
+		return pipelineRange(ctx, in, func(v interface{}) error {
+			return fn(ctx, v)
+		})
+	}})
+	return p
+}
+
+// Run starts all stages and blocks until they have returned. If any stage
+// fails (returns an error or panics), the context passed to stages will be
+// cancelled. All errors are merged into a single error, the message of which
+// is formatted by the optional ErrorFormatter argument like Group.Error.
+// Errors caused by the internal cancellation are ignored.
+func (p *Pipeline) Run(ctx context.Context, args ...interface{}) error {
+	for i, s := range p.stages {
+		if s.source != (i == 0) {
+			return errors.New("pipeline must have exactly one source as the first stage")
+		}
+	}
+
+	if len(p.stages) == 0 {
+		return errors.New("pipeline must have exactly one source as the first stage")
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		g  = &Group{Logger: p.Logger}
+		in chan interface{}
+	)
+
+	for _, s := range p.stages {
+		var (
+			s   = s
+			src = in
+			out = make(chan interface{}, p.size)
+			wg  = &sync.WaitGroup{}
+		)
+
+		wg.Add(s.workers)
+		for i := 0; i < s.workers; i++ {
+			g.Go(func() interface{} {
+				ok := false
+				defer func() {
+					// Cancel other stages if this one returns an error or panics.
+					if !ok {
+						cancel()
+					}
+					wg.Done()
+				}()
+
+				err := s.fn(ctx, src, out)
+				if ok = err == nil; !ok && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+					// The stage is cancelled by others.
+					return errPipelineCanceled
+				}
+				return err
+			})
+		}
+
+		g.Go(func() interface{} {
+			wg.Wait()
+			close(out)
+			return nil
+		})
+
+		in = out
+	}
+
+	// Values sent by the last stage are discarded.
+	last := in
+	g.Go(func() interface{} {
+		for range last {
+		}
+		return nil
+	})
+
+	var es []error
+	for _, x := range g.Result() {
+		if e, ok := x.(error); ok && e != errPipelineCanceled {
+			es = append(es, e)
+		}
+	}
+
+	// All stages are cancelled by the parent context.
+	if len(es) == 0 && parent.Err() != nil {
+		es = append(es, parent.Err())
+	}
+
+	ef := ListErrorFormatter
+	if len(args) > 0 {
+		if v, ok := args[0].(ErrorFormatter); ok {
+			ef = v
+		}
+	}
+	return ef(es)
+}
+
+// errPipelineCanceled is an internal error which indicates a stage is
+// cancelled by the failure of another stage or the parent context.
+var errPipelineCanceled = errors.New("pipeline is canceled")
+
+// pipelineSend sends a value to the channel unless the context is done.
+func pipelineSend(ctx context.Context, out chan<- interface{}, v interface{}) error {
+	select {
+	case out <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pipelineRange calls the fn function for each value received from the
+// channel until the channel is closed, the context is done or fn fails.
+func pipelineRange(ctx context.Context, in <-chan interface{}, fn func(interface{}) error) error {
+	for {
+		select {
+		case v, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
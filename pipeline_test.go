@@ -0,0 +1,141 @@
+// pipeline_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	var batches [][]interface{}
+
+	err := NewPipeline(4).
+		Source(func(ctx context.Context, emit func(interface{}) error) error {
+			for i := 0; i < 100; i++ {
+				if err := emit(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Map(8, func(ctx context.Context, v interface{}) (interface{}, error) {
+			return v.(int) * 2, nil
+		}).
+		Filter(func(v interface{}) bool {
+			return v.(int)%3 == 0
+		}).
+		Batch(10).
+		Sink(func(ctx context.Context, v interface{}) error {
+			batches = append(batches, v.([]interface{}))
+			return nil
+		}).
+		Run(context.Background())
+	assert.NoError(t, err)
+
+	var values []int
+	for i, batch := range batches {
+		if i < len(batches)-1 {
+			assert.Equal(t, 10, len(batch))
+		}
+		for _, v := range batch {
+			values = append(values, v.(int))
+		}
+	}
+	sort.Ints(values)
+
+	var expected []int
+	for i := 0; i < 100; i++ {
+		if i*2%3 == 0 {
+			expected = append(expected, i*2)
+		}
+	}
+	assert.Equal(t, expected, values)
+}
+
+func TestPipelineError(t *testing.T) {
+	source := func(ctx context.Context, emit func(interface{}) error) error {
+		for i := 0; ; i++ {
+			if err := emit(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 1. Check the first error cancels other stages.
+	err := NewPipeline(0).
+		Source(source).
+		Map(4, func(ctx context.Context, v interface{}) (interface{}, error) {
+			if v.(int) == 10 {
+				return nil, errors.New("map failed")
+			}
+			return v, nil
+		}).
+		Sink(func(ctx context.Context, v interface{}) error {
+			return nil
+		}).
+		Run(context.Background())
+	assert.EqualError(t, err, "map failed")
+
+	// 2. Check errors are aggregated by the formatter. A single error is
+	// returned unchanged.
+	err = NewPipeline(0).
+		Source(func(ctx context.Context, emit func(interface{}) error) error {
+			return errors.New("foo")
+		}).
+		Sink(func(ctx context.Context, v interface{}) error {
+			return nil
+		}).
+		Run(context.Background(), ErrorFormatter(CommaErrorFormatter))
+	assert.EqualError(t, err, "foo")
+
+	// Two stages fail independently, the source fails when the sink is
+	// failing, regardless of the context.
+	failing := make(chan struct{})
+	err = NewPipeline(0).
+		Source(func(ctx context.Context, emit func(interface{}) error) error {
+			emit(0)
+			<-failing
+			return errors.New("source failed")
+		}).
+		Sink(func(ctx context.Context, v interface{}) error {
+			close(failing)
+			return errors.New("sink failed")
+		}).
+		Run(context.Background(), ErrorFormatter(CommaErrorFormatter))
+	assert.Error(t, err)
+	assert.Contains(t, []string{
+		"sink failed,source failed",
+		"source failed,sink failed",
+	}, err.Error())
+
+	// 3. Check panic case.
+	err = NewPipeline(0).
+		Source(source).
+		Sink(func(ctx context.Context, v interface{}) error {
+			panic("oops")
+		}).
+		Run(context.Background())
+	assert.EqualError(t, err, "oops")
+
+	// 4. Check the parent context cancellation.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = NewPipeline(0).Source(source).Run(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// 5. Check invalid pipelines.
+	assert.Error(t, NewPipeline(0).Run(context.Background()))
+	assert.Error(t, NewPipeline(0).Filter(func(interface{}) bool { return true }).Run(context.Background()))
+	assert.Error(t, NewPipeline(0).Source(source).Source(source).Run(context.Background()))
+}
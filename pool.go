@@ -0,0 +1,81 @@
+// pool.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a generic object pool which wraps sync.Pool, so objects of any
+// type can be pooled without type assertions.
+type Pool[T any] struct {
+	counters poolCounters // 64-bit aligned, see poolCounters.
+	pool     sync.Pool
+	new      func() T
+
+	// Reset specifies an optional hook which is called to reset an object
+	// before it's put back to the pool.
+	Reset func(T)
+
+	// Valid specifies an optional predicate which reports whether an object
+	// can be put back to the pool. Invalid objects are discarded.
+	Valid func(T) bool
+
+	// CollectStats specifies whether the pool collects usage statistics,
+	// which can be fetched by Stats method.
+	CollectStats bool
+}
+
+// NewPool creates a Pool instance. The new parameter specifies the function
+// which generates an object when the pool is empty, it can't be nil.
+func NewPool[T any](new func() T) *Pool[T] {
+	return &Pool[T]{new: new}
+}
+
+// Get fetches an object from the pool.
+func (p *Pool[T]) Get() T {
+	if p.CollectStats {
+		atomic.AddInt64(&p.counters.gets, 1)
+	}
+
+	if x := p.pool.Get(); x != nil {
+		return x.(T)
+	}
+
+	if p.CollectStats {
+		atomic.AddInt64(&p.counters.news, 1)
+	}
+	return p.new()
+}
+
+// Put returns an object to the pool. If Valid hook is specified and the
+// object isn't valid, it will be discarded; otherwise Reset hook will be
+// called (if specified) before it's put back.
+func (p *Pool[T]) Put(x T) {
+	if p.CollectStats {
+		atomic.AddInt64(&p.counters.puts, 1)
+	}
+
+	if p.Valid != nil && !p.Valid(x) {
+		if p.CollectStats {
+			atomic.AddInt64(&p.counters.discarded, 1)
+		}
+		return
+	}
+
+	if p.Reset != nil {
+		p.Reset(x)
+	}
+	p.pool.Put(x)
+}
+
+// Stats returns a snapshot of the usage statistics of the pool.
+func (p *Pool[T]) Stats() PoolStats {
+	return p.counters.snapshot()
+}
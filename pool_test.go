@@ -0,0 +1,74 @@
+// pool_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(func() *bytes.Buffer { return new(bytes.Buffer) })
+	p.CollectStats = true
+	p.Reset = func(b *bytes.Buffer) { b.Reset() }
+	p.Valid = func(b *bytes.Buffer) bool { return b.Cap() <= 1024 }
+
+	// 1. Check Reset hook.
+	b := p.Get()
+	b.WriteString("Hello, World!")
+	p.Put(b)
+	for i := 0; i < 100; i++ {
+		b = p.Get()
+		assert.Equal(t, 0, b.Len())
+		p.Put(b)
+	}
+
+	// 2. Check Valid hook.
+	huge := p.Get()
+	huge.Grow(4096)
+	p.Put(huge)
+	for i := 0; i < 100; i++ {
+		b = p.Get()
+		assert.True(t, b != huge)
+		p.Put(b)
+	}
+
+	// 3. Check statistics.
+	stats := p.Stats()
+	assert.Equal(t, int64(202), stats.Gets)
+	assert.Equal(t, int64(202), stats.Puts)
+	assert.Equal(t, int64(1), stats.Discarded)
+	assert.True(t, stats.News >= 1)
+	assert.Equal(t, int64(0), stats.Outstanding)
+}
+
+func TestPoolGzipWriter(t *testing.T) {
+	var (
+		out = &bytes.Buffer{}
+		p   = NewPool(func() *gzip.Writer { return gzip.NewWriter(io.Discard) })
+	)
+	p.Reset = func(w *gzip.Writer) { w.Reset(io.Discard) }
+
+	for i := 0; i < 10; i++ {
+		out.Reset()
+		w := p.Get()
+		w.Reset(out)
+		w.Write([]byte("Hello, World!"))
+		w.Close()
+		p.Put(w)
+
+		r, err := gzip.NewReader(out)
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(r)
+		assert.Equal(t, "Hello, World!", string(data))
+	}
+}
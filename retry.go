@@ -0,0 +1,209 @@
+// retry.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter specifies how to randomize backoff durations, which can prevent
+// many clients from retrying at the same time.
+type Jitter int
+
+const (
+	// NoJitter means backoff durations won't be randomized.
+	NoJitter Jitter = iota
+
+	// FullJitter means a backoff duration d will be replaced by a random
+	// duration in [0, d).
+	FullJitter
+
+	// EqualJitter means a backoff duration d will be replaced by a random
+	// duration in [d/2, d).
+	EqualJitter
+)
+
+// Backoff specifies an exponential backoff strategy. The zero value is
+// ready to use, which starts from 100ms and doubles each time without
+// an upper bound.
+type Backoff struct {
+	// Initial specifies the backoff duration after the first attempt.
+	// If it's not positive, 100ms will be used.
+	Initial time.Duration
+
+	// Max specifies the upper bound of backoff durations (before jitter).
+	// If it's not positive, there is no upper bound.
+	Max time.Duration
+
+	// Multiplier specifies the factor by which the backoff duration grows
+	// after each attempt. If it's less than 1, 2 will be used.
+	Multiplier float64
+
+	// Jitter specifies how to randomize backoff durations.
+	Jitter Jitter
+}
+
+// Duration returns the backoff duration after the n-th (starts from 1) attempt.
+func (b Backoff) Duration(n int) time.Duration {
+	var (
+		initial    = b.Initial
+		multiplier = b.Multiplier
+	)
+
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	if n < 1 {
+		n = 1
+	}
+
+	f := float64(initial) * math.Pow(multiplier, float64(n-1))
+	if b.Max > 0 && f > float64(b.Max) {
+		f = float64(b.Max)
+	}
+
+	// Avoid overflow of time.Duration.
+	if f > math.MaxInt64/2 {
+		f = math.MaxInt64 / 2
+	}
+
+	d := time.Duration(f)
+	switch b.Jitter {
+	case FullJitter:
+		d = randDuration(d)
+	case EqualJitter:
+		d = d/2 + randDuration(d-d/2)
+	}
+	return d
+}
+
+// randDuration returns a random duration in [0, d).
+func randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// RetryPolicy specifies how Retry function retries a function call.
+type RetryPolicy struct {
+	// Backoff specifies the backoff durations between attempts.
+	Backoff
+
+	// MaxAttempts specifies the maximum number of attempts (including the
+	// first one). If it's not positive, there is no limit.
+	MaxAttempts int
+
+	// MaxElapsed specifies the maximum elapsed time since the first attempt.
+	// Retry function won't start an attempt which can't begin before this
+	// deadline. If it's not positive, there is no limit.
+	MaxElapsed time.Duration
+
+	// Retryable specifies an optional predicate which reports whether an
+	// error is retryable. If it's nil, an error is retryable when its type
+	// is *util.Error and its code is in RetryableCodes, or it implements
+	// Timeout or Temporary method (like net.Error) which returns true.
+	// Errors caused by context are never retryable in this case. Unlike the
+	// default failure classification of CircuitBreaker, unknown errors are
+	// not retryable, cause the function might not be idempotent.
+	Retryable func(error) bool
+
+	// RetryableCodes specifies error codes of *util.Error which are
+	// retryable. It only works when Retryable field is nil.
+	RetryableCodes []int
+
+	// Formatter specifies the formatter which merges errors of all attempts
+	// into a single error. If it's nil, ListErrorFormatter will be used.
+	Formatter ErrorFormatter
+}
+
+// Retry calls the function until it returns nil, or the error isn't retryable,
+// or the limits of the policy have been reached, or the context is done. The
+// returned error is merged from errors of all attempts (and the context error
+// if the context is done) by the policy's formatter.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	var (
+		es    []error
+		begin = time.Now()
+		ef    = policy.Formatter
+	)
+
+	if ef == nil {
+		ef = ListErrorFormatter
+	}
+
+	for n := 1; ; n++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		es = append(es, err)
+
+		if !policy.retryable(err) {
+			return ef(es)
+		}
+
+		if policy.MaxAttempts > 0 && n >= policy.MaxAttempts {
+			return ef(es)
+		}
+
+		d := policy.Duration(n)
+		if policy.MaxElapsed > 0 && time.Since(begin)+d > policy.MaxElapsed {
+			return ef(es)
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ef(append(es, ctx.Err()))
+		}
+	}
+}
+
+// retryable reports whether an error is retryable according to the policy.
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var ue *Error
+	if errors.As(err, &ue) {
+		for _, code := range p.RetryableCodes {
+			if ue.Code == code {
+				return true
+			}
+		}
+	}
+
+	var te interface{ Timeout() bool }
+	if errors.As(err, &te) && te.Timeout() {
+		return true
+	}
+
+	var ne interface{ Temporary() bool }
+	if errors.As(err, &ne) && ne.Temporary() {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,152 @@
+// retry_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for _, cs := range []struct {
+		N        int           `json:"n"`
+		Duration time.Duration `json:"duration"`
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{100, 50 * time.Millisecond},
+	} {
+		t.Run(encodeCase(cs), func(t *testing.T) {
+			assert.Equal(t, cs.Duration, b.Duration(cs.N))
+		})
+	}
+
+	assert.Equal(t, 400*time.Millisecond, Backoff{}.Duration(3))
+
+	for i := 0; i < 1000; i++ {
+		b.Jitter = FullJitter
+		d := b.Duration(3)
+		assert.True(t, d >= 0 && d < 40*time.Millisecond)
+
+		b.Jitter = EqualJitter
+		d = b.Duration(3)
+		assert.True(t, d >= 20*time.Millisecond && d < 40*time.Millisecond)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{
+		Backoff:        Backoff{Initial: time.Millisecond},
+		MaxAttempts:    3,
+		RetryableCodes: []int{503},
+	}
+
+	// 1. Check success after retries.
+	n := 0
+	err := Retry(context.Background(), policy, func(ctx context.Context) error {
+		if n++; n < 3 {
+			return Errorf(503, "unavailable %d", n)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// 2. Check all attempts are listed in the final error.
+	n = 0
+	err = Retry(context.Background(), policy, func(ctx context.Context) error {
+		n++
+		return Errorf(503, "unavailable %d", n)
+	})
+	assert.Equal(t, 3, n)
+	assert.EqualError(t, err, `multiple (3) errors:
+   1. unavailable 1
+   2. unavailable 2
+   3. unavailable 3`)
+
+	// 3. Check non-retryable errors.
+	n = 0
+	err = Retry(context.Background(), policy, func(ctx context.Context) error {
+		n++
+		return Errorf(400, "bad request")
+	})
+	assert.Equal(t, 1, n)
+	assert.EqualError(t, err, "bad request")
+
+	// 4. Check net.Error classification.
+	n = 0
+	err = Retry(context.Background(), policy, func(ctx context.Context) error {
+		n++
+		return &net.DNSError{Err: "timeout", IsTimeout: true}
+	})
+	assert.Equal(t, 3, n)
+	assert.Error(t, err)
+
+	// 5. Check custom predicate and formatter.
+	n = 0
+	policy.Retryable = func(error) bool { return true }
+	policy.Formatter = CommaErrorFormatter
+	err = Retry(context.Background(), policy, func(ctx context.Context) error {
+		n++
+		return fmt.Errorf("e%d", n)
+	})
+	assert.EqualError(t, err, "e1,e2,e3")
+
+	// 6. Check *util.Error isn't retryable if its code isn't in RetryableCodes.
+	policy = RetryPolicy{Backoff: Backoff{Initial: time.Millisecond}, MaxAttempts: 3}
+	for _, err := range []error{
+		Errorf(503, "unavailable"),
+		Errorf(-1, "failed"),
+		FromJson([]byte("{"), &struct{}{}),
+	} {
+		n = 0
+		Retry(context.Background(), policy, func(ctx context.Context) error {
+			n++
+			return err
+		})
+		assert.Equal(t, 1, n, err.Error())
+	}
+}
+
+func TestRetryLimits(t *testing.T) {
+	// 1. Check MaxElapsed.
+	n := 0
+	policy := RetryPolicy{
+		Backoff:    Backoff{Initial: 20 * time.Millisecond, Multiplier: 1},
+		MaxElapsed: 50 * time.Millisecond,
+		Retryable:  func(error) bool { return true },
+	}
+	err := Retry(context.Background(), policy, func(ctx context.Context) error {
+		n++
+		return errors.New("failed")
+	})
+	assert.Error(t, err)
+	assert.True(t, n >= 2 && n <= 3)
+
+	// 2. Check context cancellation.
+	n = 0
+	policy.MaxElapsed = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = Retry(ctx, policy, func(ctx context.Context) error {
+		n++
+		return errors.New("failed")
+	})
+	assert.True(t, n >= 2)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+}
@@ -0,0 +1,162 @@
+// wpool.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	// ErrPoolClosed is returned when submitting a task to a WorkerPool
+	// which has been shut down.
+	ErrPoolClosed = errors.New("worker pool is closed")
+
+	// ErrPoolFull is returned by TrySubmit method when the task queue
+	// of a WorkerPool is full.
+	ErrPoolFull = errors.New("worker pool is full")
+)
+
+// WorkerPool is a collection of long-lived goroutines (workers) which
+// execute tasks from a bounded queue. Compared with Group, it doesn't
+// spawn a new goroutine for each task and doesn't collect results.
+type WorkerPool struct {
+	wg     sync.WaitGroup
+	locker sync.RWMutex
+	once   sync.Once
+	closed bool
+	queue  chan func()
+	quit   chan struct{} // Notify submitters the pool is closing.
+	drain  chan struct{} // Notify workers there will be no more tasks.
+
+	// Logger specifies an optional logger for unexpected behaviors, which
+	// lead to panic, from tasks.
+	Logger *log.Logger
+}
+
+// NewWorkerPool creates a WorkerPool instance and starts its workers. The
+// workers parameter specifies the number of workers and the size parameter
+// specifies the capacity of the task queue. workers must be positive and
+// size can't be negative.
+func NewWorkerPool(workers, size int) *WorkerPool {
+	wp := &WorkerPool{
+		queue: make(chan func(), size),
+		quit:  make(chan struct{}),
+		drain: make(chan struct{}),
+	}
+
+	wp.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go wp.work()
+	}
+	return wp
+}
+
+// Submit puts a task into the queue. If the queue is full, it blocks until
+// there is free space, the context is done or the pool is shut down.
+func (wp *WorkerPool) Submit(ctx context.Context, f func()) error {
+	wp.locker.RLock()
+	defer wp.locker.RUnlock()
+
+	if wp.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case wp.queue <- f:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wp.quit:
+		return ErrPoolClosed
+	}
+}
+
+// TrySubmit puts a task into the queue without blocking. If the queue is
+// full, returns ErrPoolFull.
+func (wp *WorkerPool) TrySubmit(f func()) error {
+	wp.locker.RLock()
+	defer wp.locker.RUnlock()
+
+	if wp.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case wp.queue <- f:
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
+// Shutdown stops accepting new tasks and waits for workers to execute all
+// tasks remaining in the queue. If the context is done before all workers
+// have exited, returns the context error; workers will continue draining
+// the queue in background.
+func (wp *WorkerPool) Shutdown(ctx context.Context) error {
+	wp.once.Do(func() {
+		// Wake up submitters blocked on a full queue at first, otherwise
+		// we can't acquire the write lock.
+		close(wp.quit)
+
+		wp.locker.Lock()
+		wp.closed = true
+		wp.locker.Unlock()
+
+		// No task will be put into the queue after this point.
+		close(wp.drain)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work is the main loop of a worker.
+func (wp *WorkerPool) work() {
+	defer wp.wg.Done()
+
+	for {
+		select {
+		case f := <-wp.queue:
+			wp.exec(f)
+		case <-wp.drain:
+			for {
+				select {
+				case f := <-wp.queue:
+					wp.exec(f)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// exec executes a task and recovers the panic caused by it.
+func (wp *WorkerPool) exec(f func()) {
+	defer func() {
+		if x := recover(); x != nil && wp.Logger != nil {
+			wp.Logger.Printf("panic: %v\n%s", x, debug.Stack())
+		}
+	}()
+	f()
+}
@@ -0,0 +1,95 @@
+// wpool_test.go
+//
+// Author: blinklv <blinklv@icloud.com>
+// Create Time: 2026-10-19
+// Maintainer: blinklv <blinklv@icloud.com>
+// Last Change: 2026-10-19
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool(t *testing.T) {
+	var (
+		out   = &bytes.Buffer{}
+		wp    = NewWorkerPool(4, 16)
+		count int64
+	)
+	wp.Logger = log.New(out, "", 0)
+
+	// 1. Check normal case.
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, wp.Submit(context.Background(), func() {
+			atomic.AddInt64(&count, 1)
+		}))
+	}
+
+	// 2. Check panic case.
+	assert.NoError(t, wp.Submit(context.Background(), func() {
+		panic("oops")
+	}))
+
+	// 3. Check all tasks in queue are drained.
+	assert.NoError(t, wp.Shutdown(context.Background()))
+	assert.Equal(t, int64(1000), atomic.LoadInt64(&count))
+	assert.True(t, strings.HasPrefix(out.String(), "panic: oops\n"))
+
+	// 4. Check submitting tasks after shutdown.
+	assert.Equal(t, ErrPoolClosed, wp.Submit(context.Background(), func() {}))
+	assert.Equal(t, ErrPoolClosed, wp.TrySubmit(func() {}))
+	assert.NoError(t, wp.Shutdown(context.Background()))
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	var (
+		wp      = NewWorkerPool(1, 1)
+		release = make(chan struct{})
+		started = make(chan struct{})
+	)
+
+	// Occupy the only worker and fill up the queue.
+	assert.NoError(t, wp.TrySubmit(func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	assert.NoError(t, wp.TrySubmit(func() {}))
+	assert.Equal(t, ErrPoolFull, wp.TrySubmit(func() {}))
+
+	// Submit blocks until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, wp.Submit(ctx, func() {}))
+
+	// Submit blocked on a full queue is woken up by Shutdown.
+	var (
+		wg  sync.WaitGroup
+		err error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err = wp.Submit(context.Background(), func() {})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, wp.Shutdown(ctx))
+	wg.Wait()
+	assert.Equal(t, ErrPoolClosed, err)
+
+	close(release)
+	assert.NoError(t, wp.Shutdown(context.Background()))
+}